@@ -0,0 +1,213 @@
+// templatemap 命令行执行模板，用于调试模板及执行器配置
+//
+//	templatemap -dir ./tpl -config provider.yaml -tpl getPaginate -input '{"PageIndex":"0","PageSize":"20"}'
+//
+// 执行器配置文件(json/yaml，按扩展名区分):
+//
+//	providers:
+//	  - type: SQL # 执行器注册名称，见 provider.Providers()
+//	    config: # 执行器配置，转换为 json 后由执行器工厂解析
+//	      dsn: root:123456@tcp(127.0.0.1:3306)/test
+//	    templates: ["get*", "insert*"] # 使用该执行器的模板(path.Match 规则)，为空时匹配全部模板
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/templatemap"
+	"github.com/suifengpiao14/templatemap/provider"
+	"github.com/tidwall/gjson"
+	"gopkg.in/yaml.v3"
+)
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		os.Exit(1)
+	}
+}
+
+type providerConfig struct {
+	Type      string                 `json:"type" yaml:"type"`
+	Config    map[string]interface{} `json:"config" yaml:"config"`
+	Templates []string               `json:"templates" yaml:"templates"`
+}
+
+type config struct {
+	Providers []providerConfig `json:"providers" yaml:"providers"`
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (err error) {
+	defer func() {
+		if panicInfo := recover(); panicInfo != nil { // 模板解析失败时 panic
+			err = errors.Errorf("%v", panicInfo)
+		}
+	}()
+	flagSet := flag.NewFlagSet("templatemap", flag.ContinueOnError)
+	flagSet.SetOutput(stderr)
+	dir := flagSet.String("dir", ".", "模板目录，加载目录下全部 *.tpl 文件")
+	configFile := flagSet.String("config", "", "执行器配置文件(json/yaml)")
+	tplName := flagSet.String("tpl", "", "执行的模板名称")
+	input := flagSet.String("input", "{}", "容器数据(json 对象)，@file 从文件读取，- 从标准输入读取")
+	dryRun := flagSet.Bool("dry-run", false, "只输出生成的 SQL/HTTP/命令，不调用执行器")
+	timeout := flagSet.Duration("timeout", 0, "执行超时时间，如 10s，0 不限制")
+	err = flagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *tplName == "" {
+		flagSet.Usage()
+		err = errors.Errorf("-tpl required")
+		return err
+	}
+	inputJson, err := readInput(*input, stdin)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	options := make([]templatemap.RepositoryOption, 0)
+	var capture *provider.CaptureExecProvider
+	if *dryRun {
+		capture = provider.NewCaptureExecProvider(nil)
+		options = append(options, templatemap.WithCaptureProvider(capture))
+	}
+	r := templatemap.NewRepository(options...)
+	tplNames := r.AddTemplateByDir(*dir)
+	if !r.TemplateExists(*tplName) {
+		err = errors.Errorf("template %s not found in %s", *tplName, *dir)
+		return err
+	}
+	execProviders, err := makeExecProviders(cfg)
+	if err != nil {
+		return err
+	}
+	for _, name := range tplNames {
+		var execProvider provider.ExecproviderInterface
+		for i, providerCfg := range cfg.Providers {
+			if matchTemplate(providerCfg.Templates, name) {
+				execProvider = execProviders[i]
+				break
+			}
+		}
+		if execProvider == nil && capture != nil {
+			execProvider = capture // dry-run 时未配置执行器的模板同样记录
+		}
+		if execProvider != nil {
+			r.RegisterMeta(name, &templatemap.TemplateMeta{Name: name, ExecProvider: execProvider})
+		}
+	}
+
+	volume := templatemap.NewVolume(r)
+	templatemap.SetInputToVolume(volume, inputJson, nil)
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	out, err := r.ExecuteTemplateContext(ctx, *tplName, volume)
+	if capture != nil {
+		for _, record := range capture.Records() {
+			fmt.Fprintf(stdout, "-- %s\n%s\n", record.Identifier, record.Input)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, out)
+	return nil
+}
+
+func readInput(input string, stdin io.Reader) (string, error) {
+	var b []byte
+	var err error
+	switch {
+	case input == "-":
+		b, err = io.ReadAll(stdin)
+	case strings.HasPrefix(input, "@"):
+		b, err = os.ReadFile(input[1:])
+	default:
+		b = []byte(input)
+	}
+	if err != nil {
+		return "", err
+	}
+	inputJson := strings.TrimSpace(string(b))
+	if inputJson == "" {
+		inputJson = "{}"
+	}
+	if !gjson.Valid(inputJson) || !gjson.Parse(inputJson).IsObject() {
+		err = errors.Errorf("input must be a json object, got: %s", inputJson)
+		return "", err
+	}
+	return inputJson, nil
+}
+
+func loadConfig(filename string) (*config, error) {
+	cfg := &config{}
+	if filename == "" {
+		return cfg, nil
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, cfg)
+	default:
+		err = json.Unmarshal(b, cfg)
+	}
+	if err != nil {
+		err = errors.WithMessagef(err, "parse config %s", filename)
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// makeExecProviders 通过执行器注册表创建执行器，顺序与配置一致
+func makeExecProviders(cfg *config) ([]provider.ExecproviderInterface, error) {
+	execProviders := make([]provider.ExecproviderInterface, 0, len(cfg.Providers))
+	for _, providerCfg := range cfg.Providers {
+		configJson := ""
+		if providerCfg.Config != nil {
+			b, err := json.Marshal(providerCfg.Config)
+			if err != nil {
+				return nil, err
+			}
+			configJson = string(b)
+		}
+		execProvider, err := provider.MakeExecProvider(providerCfg.Type, configJson)
+		if err != nil {
+			return nil, err
+		}
+		execProviders = append(execProviders, execProvider)
+	}
+	return execProviders, nil
+}
+
+func matchTemplate(patterns []string, tplName string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, tplName); ok {
+			return true
+		}
+	}
+	return false
+}
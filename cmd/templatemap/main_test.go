@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testTpl = `
+{{define "getUser"}}select * from user where id=:ID{{end}}
+{{define "greet"}}echo hello {{.name}}{{end}}
+{{define "main"}}{{execSQLTpl . "getUser"}}{{execCURLTpl . "greet"}}{{getValue . "greetOut"}}{{end}}
+{{define "sayHello"}}{{execCURLTpl . "greet"}}{{getValue . "greetOut"}}{{end}}
+{{define "plain"}}{{.name}}-{{.ID}}{{end}}
+`
+
+const testYamlConfig = `
+providers:
+  - type: SQL
+    config:
+      dsn: root:123456@tcp(127.0.0.1:3306)/test
+      logLevel: debug
+    templates: ["get*"]
+  - type: BIN
+    templates: ["greet"]
+`
+
+func writeTestFiles(t *testing.T) (dir string, configFile string) {
+	dir = t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "user.tpl"), []byte(testTpl), 0o644)
+	if err != nil {
+		panic(err)
+	}
+	configFile = filepath.Join(dir, "provider.yaml")
+	err = os.WriteFile(configFile, []byte(testYamlConfig), 0o644)
+	if err != nil {
+		panic(err)
+	}
+	return dir, configFile
+}
+
+func TestRunDryRun(t *testing.T) {
+	dir, configFile := writeTestFiles(t)
+	var stdout, stderr bytes.Buffer
+	args := []string{"-dir", dir, "-config", configFile, "-tpl", "main", "-input", `{"ID":1,"name":"张三"}`, "-dry-run"}
+	err := run(args, nil, &stdout, &stderr)
+	if err != nil {
+		panic(err)
+	}
+	out := stdout.String()
+	for _, want := range []string{"-- getUser\nselect * from user where id=1", "-- greet\necho hello 张三"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("got %s, want contains %s", out, want)
+		}
+	}
+}
+
+func TestRunDryRunWithoutConfig(t *testing.T) {
+	dir, _ := writeTestFiles(t)
+	var stdout, stderr bytes.Buffer
+	args := []string{"-dir", dir, "-tpl", "main", "-input", `{"ID":1,"name":"张三","__repository":"x"}`, "-dry-run"}
+	err := run(args, nil, &stdout, &stderr)
+	if err != nil {
+		panic(err)
+	}
+	out := stdout.String()
+	for _, want := range []string{"-- getUser\nselect * from user where id=1", "-- greet\necho hello 张三"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("got %s, want contains %s", out, want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, _ := writeTestFiles(t)
+	configFile := filepath.Join(dir, "provider.json")
+	err := os.WriteFile(configFile, []byte(`{"providers":[{"type":"BIN","templates":["greet"]}]}`), 0o644)
+	if err != nil {
+		panic(err)
+	}
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader(`{"name":"张三","ID":1}`)
+	err = run([]string{"-dir", dir, "-config", configFile, "-tpl", "plain", "-input", "-"}, stdin, &stdout, &stderr)
+	if err != nil {
+		panic(err)
+	}
+	if out := stdout.String(); out != "张三-1\n" {
+		t.Errorf("got %q", out)
+	}
+
+	stdout.Reset()
+	err = run([]string{"-dir", dir, "-config", configFile, "-tpl", "sayHello", "-input", `{"name":"world"}`}, nil, &stdout, &stderr)
+	if err != nil {
+		panic(err)
+	}
+	if out := stdout.String(); out != "hello world\n" {
+		t.Errorf("got %q", out)
+	}
+
+	err = run([]string{"-dir", dir, "-tpl", "none"}, nil, &stdout, &stderr)
+	if err == nil {
+		t.Error("expected template not found error")
+	}
+}
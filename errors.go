@@ -0,0 +1,189 @@
+package templatemap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/templatemap/util"
+)
+
+var rxErrorCalling = regexp.MustCompile(`error calling (\S+?):`)
+
+// ExecuteError 模板执行错误，保留原始错误、模板调用栈(外层在前)及出错的模板函数
+type ExecuteError struct {
+	TplStack []string
+	FuncName string
+	Err      error
+}
+
+func (e *ExecuteError) Error() string {
+	msg := fmt.Sprintf("execute template %s", strings.Join(e.TplStack, "->"))
+	if e.FuncName != "" {
+		msg = fmt.Sprintf("%s, func %s", msg, e.FuncName)
+	}
+	return fmt.Sprintf("%s: %v", msg, e.Err)
+}
+
+// TplName 出错的模板名称(调用栈最内层)
+func (e *ExecuteError) TplName() string {
+	if len(e.TplStack) == 0 {
+		return ""
+	}
+	return e.TplStack[len(e.TplStack)-1]
+}
+
+// Cause 兼容 github.com/pkg/errors.Cause
+func (e *ExecuteError) Cause() error {
+	return e.Err
+}
+
+func (e *ExecuteError) Unwrap() error {
+	return e.Err
+}
+
+// newExecuteError 将 text/template 返回的错误转换为 ExecuteError，嵌套模板的错误合并调用栈
+func newExecuteError(tplName string, err error) *ExecuteError {
+	var inner *ExecuteError
+	if errors.As(err, &inner) {
+		stack := make([]string, 0, len(inner.TplStack)+1)
+		stack = append(stack, tplName)
+		stack = append(stack, inner.TplStack...)
+		return &ExecuteError{
+			TplStack: stack,
+			FuncName: inner.FuncName,
+			Err:      inner.Err,
+		}
+	}
+	executeError := &ExecuteError{
+		TplStack: []string{tplName},
+		Err:      err,
+	}
+	defer fillBusinessErrorTplName(executeError)
+	var execErr template.ExecError
+	if !errors.As(err, &execErr) {
+		return executeError
+	}
+	if execErr.Name != "" && execErr.Name != tplName { // {{template "xxx" .}} 引用的模板出错
+		executeError.TplStack = append(executeError.TplStack, execErr.Name)
+	}
+	if matches := rxErrorCalling.FindStringSubmatch(execErr.Err.Error()); len(matches) == 2 {
+		executeError.FuncName = matches[1]
+		if cause := errors.Unwrap(execErr.Err); cause != nil {
+			executeError.Err = cause // 模板函数返回的原始错误
+		}
+	}
+	return executeError
+}
+
+func fillBusinessErrorTplName(executeError *ExecuteError) {
+	var businessError *BusinessError
+	if errors.As(executeError.Err, &businessError) && businessError.TplName == "" {
+		businessError.TplName = executeError.TplName()
+	}
+}
+
+// recoverError 将 recover 获取的值转换为 error
+func recoverError(panicInfo interface{}) error {
+	if err, ok := panicInfo.(error); ok {
+		return errors.WithStack(err)
+	}
+	return errors.Errorf("%v", panicInfo)
+}
+
+// BusinessError 业务错误，由模板函数 panic 返回，调用方通过 errors.As 获取
+type BusinessError struct {
+	HttpCode     int
+	BusinessCode string
+	Msg          string
+	TplName      string
+	Data         interface{}
+}
+
+// NewBusinessError httpCode 无法解析为整数时使用 500
+func NewBusinessError(httpCode interface{}, businessCode string, msg string) *BusinessError {
+	code, err := strconv.Atoi(strval(httpCode))
+	if err != nil || code < 100 || code > 599 {
+		code = http.StatusInternalServerError
+	}
+	return &BusinessError{
+		HttpCode:     code,
+		BusinessCode: businessCode,
+		Msg:          msg,
+	}
+}
+
+// Error 保持与原 "httpCode#businessCode#msg" 格式一致
+func (e *BusinessError) Error() string {
+	return fmt.Sprintf("%d#%s#%s", e.HttpCode, e.BusinessCode, e.Msg)
+}
+
+// ErrorBody json 格式错误响应体
+type ErrorBody struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// ErrorBody 生成 json 错误响应体
+func (e *BusinessError) ErrorBody() ErrorBody {
+	return ErrorBody{
+		Code:    e.BusinessCode,
+		Message: e.Msg,
+		Data:    e.Data,
+	}
+}
+
+// ErrorResponse 将错误转换为 http 状态码及 json 响应体，输入校验错误返回 400 及字段错误，其余非业务错误统一返回 500，不暴露内部错误信息
+func ErrorResponse(err error) (httpStatus int, body []byte) {
+	var errorBody ErrorBody
+	var businessError *BusinessError
+	var validateError *util.ValidateError
+	if errors.As(err, &businessError) {
+		httpStatus = businessError.HttpCode
+		errorBody = businessError.ErrorBody()
+	} else if errors.As(err, &validateError) {
+		httpStatus = http.StatusBadRequest
+		errorBody = ErrorBody{
+			Code:    strconv.Itoa(httpStatus),
+			Message: validateError.Error(),
+			Data:    validateError.Errors,
+		}
+	} else {
+		httpStatus = http.StatusInternalServerError
+		errorBody = ErrorBody{
+			Code:    strconv.Itoa(httpStatus),
+			Message: http.StatusText(httpStatus),
+		}
+	}
+	body, marshalErr := json.Marshal(errorBody)
+	if marshalErr != nil { // Data 无法序列化时丢弃
+		errorBody.Data = nil
+		body, _ = json.Marshal(errorBody)
+	}
+	return httpStatus, body
+}
+
+// ParallelError execParallel 汇总的错误，TplNames 与 Errors 一一对应
+type ParallelError struct {
+	TplNames []string
+	Errors   []error
+}
+
+func (e *ParallelError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", e.TplNames[i], err))
+	}
+	return fmt.Sprintf("execParallel %d errors: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap 支持 errors.Is/errors.As 匹配任意子模板错误
+func (e *ParallelError) Unwrap() []error {
+	return e.Errors
+}
@@ -30,3 +30,9 @@ select * from `api` where 1=1 {{template "PaginateWhere" .}} and `deleted_at` is
 {{end}}
 {{end}}
 
+
+{{define "getPaginateParallel"}}
+{{setValue . "Offset" (mul (getValue . "PageIndex") (getValue . "PageSize"))}}
+{{setValue . "Limit" (atoi (getValue . "PageSize"))}}
+{{execParallel . "PaginateTotal" "Paginate"}}
+{{end}}
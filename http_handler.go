@@ -0,0 +1,234 @@
+package templatemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/templatemap/util"
+	"github.com/tidwall/gjson"
+)
+
+const DEFAULT_HTTP_MAX_BODY_SIZE = 10 << 20 // 请求体默认最大字节数
+
+// HTTPHandler 将设置了 Path 的 api 模板发布为 http 接口，路由在创建时根据模板元数据生成
+type HTTPHandler struct {
+	repository  RepositoryInterface
+	routes      map[string]map[string]string // path -> method -> 模板名称，method 为空时不限制
+	maxBodySize int64
+}
+
+// HTTPHandlerOption http 接口配置项
+type HTTPHandlerOption func(h *HTTPHandler)
+
+// WithMaxBodySize 设置请求体最大字节数(默认 DEFAULT_HTTP_MAX_BODY_SIZE)，超过时返回 413，size<1 时不限制
+func WithMaxBodySize(size int64) HTTPHandlerOption {
+	return func(h *HTTPHandler) {
+		h.maxBodySize = size
+	}
+}
+
+// NewHTTPHandler 创建 http 接口，同一路径及方法对应多个模板时返回错误
+func NewHTTPHandler(r RepositoryInterface, options ...HTTPHandlerOption) (*HTTPHandler, error) {
+	h := &HTTPHandler{
+		repository:  r,
+		routes:      make(map[string]map[string]string),
+		maxBodySize: DEFAULT_HTTP_MAX_BODY_SIZE,
+	}
+	for _, option := range options {
+		option(h)
+	}
+	for tplName, meta := range r.GetMetas() {
+		if meta == nil || meta.Path == "" {
+			continue
+		}
+		method := strings.ToUpper(meta.Method)
+		methods, ok := h.routes[meta.Path]
+		if !ok {
+			methods = make(map[string]string)
+			h.routes[meta.Path] = methods
+		}
+		if exists, ok := methods[method]; ok {
+			err := errors.Errorf("route %s %s conflict: %s, %s", method, meta.Path, exists, tplName)
+			return nil, err
+		}
+		methods[method] = tplName
+	}
+	return h, nil
+}
+
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	methods, ok := h.routes[req.URL.Path]
+	if !ok {
+		writeErrorStatus(w, http.StatusNotFound)
+		return
+	}
+	tplName, ok := methods[req.Method]
+	if !ok {
+		tplName, ok = methods[""]
+	}
+	if !ok {
+		allow := make([]string, 0, len(methods))
+		for method := range methods {
+			allow = append(allow, method)
+		}
+		sort.Strings(allow)
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		writeErrorStatus(w, http.StatusMethodNotAllowed)
+		return
+	}
+	var inputMeta *LineschemaMeta
+	if meta, ok := h.repository.GetMeta(tplName); ok {
+		inputMeta = meta.LineschemaMeta
+	}
+	if h.maxBodySize > 0 {
+		req.Body = http.MaxBytesReader(w, req.Body, h.maxBodySize)
+	}
+	input, err := decodeHTTPInput(req, inputMeta, h.maxBodySize)
+	if err == nil {
+		var out string
+		ctx := ContextWithHeader(req.Context(), requestHeader(req))
+		out, err = h.repository.InvokeContext(ctx, tplName, input)
+		if err == nil {
+			contentType := "text/plain; charset=utf-8"
+			if gjson.Valid(out) {
+				contentType = "application/json; charset=utf-8"
+			}
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, out)
+			return
+		}
+	}
+	httpStatus, body := ErrorResponse(err)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(httpStatus)
+	w.Write(body)
+}
+
+func writeErrorStatus(w http.ResponseWriter, httpStatus int) {
+	body, _ := json.Marshal(ErrorBody{
+		Code:    strconv.Itoa(httpStatus),
+		Message: http.StatusText(httpStatus),
+	})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(httpStatus)
+	w.Write(body)
+}
+
+// decodeHTTPInput 合并 query、body(json 或表单)为输入 json，同名参数 body 优先；
+// query 及表单的值为字符串，根据输入元数据顶层属性类型转换；maxBodySize 大于 0 时 req.Body 需已由 http.MaxBytesReader 限制，超过时返回 413 错误
+func decodeHTTPInput(req *http.Request, meta *LineschemaMeta, maxBodySize int64) (string, error) {
+	var schema *Schema
+	if meta != nil && meta.JsonSchema != "" {
+		schema = NewJsonSchema(meta.JsonSchema)
+	}
+	input := make(map[string]interface{})
+	setFormValues(input, req.URL.Query(), schema)
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		if maxBodySize > 0 && int64(len(body)) >= maxBodySize { // http.MaxBytesReader 读取到上限后返回错误
+			httpStatus := http.StatusRequestEntityTooLarge
+			return "", errors.WithStack(NewBusinessError(httpStatus, strconv.Itoa(httpStatus), http.StatusText(httpStatus)))
+		}
+		return "", err
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		switch mediaType {
+		case "application/x-www-form-urlencoded":
+			form, err := url.ParseQuery(string(body))
+			if err != nil {
+				return "", newInputError("invalid_form", err.Error())
+			}
+			setFormValues(input, form, schema)
+		default:
+			bodyMap := make(map[string]interface{})
+			decoder := json.NewDecoder(bytes.NewReader(body))
+			decoder.UseNumber()
+			if err := decoder.Decode(&bodyMap); err != nil {
+				return "", newInputError("invalid_json", "Body must be a JSON object")
+			}
+			for key, value := range bodyMap {
+				input[key] = value
+			}
+		}
+	}
+	b, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// requestHeader 请求头，多个值以逗号连接，通过 ContextWithHeader 写入容器 HEADER_KEY
+func requestHeader(req *http.Request) map[string]string {
+	header := make(map[string]string, len(req.Header))
+	for key, values := range req.Header {
+		header[key] = strings.Join(values, ",")
+	}
+	return header
+}
+
+func newInputError(typ string, description string) error {
+	err := &util.ValidateError{Errors: []util.ValidateFieldError{
+		{Field: "(root)", Type: typ, Description: description},
+	}}
+	return errors.WithStack(err)
+}
+
+func setFormValues(input map[string]interface{}, form url.Values, schema *Schema) {
+	for key, values := range form {
+		if len(values) == 0 {
+			continue
+		}
+		var property *Schema
+		if schema != nil {
+			property = schema.Properties[key]
+		}
+		if property == nil {
+			input[key] = values[0]
+			continue
+		}
+		typ, _ := property.Type()
+		if typ != "array" {
+			input[key] = convertFormValue(typ, values[0])
+			continue
+		}
+		itemType := ""
+		if property.Items != nil {
+			itemType, _ = property.Items.Type()
+		}
+		arr := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			arr = append(arr, convertFormValue(itemType, value))
+		}
+		input[key] = arr
+	}
+}
+
+// convertFormValue 无法转换时保留字符串，由输入校验返回错误
+func convertFormValue(typ string, value string) interface{} {
+	switch typ {
+	case "integer":
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v
+		}
+	case "number":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v
+		}
+	case "boolean":
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	}
+	return value
+}
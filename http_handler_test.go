@@ -0,0 +1,97 @@
+package templatemap
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestHTTPServer(t *testing.T) *httptest.Server {
+	r := NewRepository()
+	r.AddTemplateByStr("getUser", `{"id":{{.ID}},"token":"{{getValue . "__header.X-Token"}}"}`)
+	r.AddTemplateByStr("createUser", `{{if eq .name "admin"}}{{panic 403 "20001" "forbidden"}}{{end}}{"name":"{{.name}}"}`)
+	inputMeta, err := NewLineschemaMeta(`fullname=id,type=integer,required,dst=ID`)
+	if err != nil {
+		panic(err)
+	}
+	r.RegisterMeta("getUser", &TemplateMeta{Name: "getUser", LineschemaMeta: inputMeta, Method: http.MethodGet, Path: "/user"})
+	r.RegisterMeta("createUser", &TemplateMeta{Name: "createUser", Method: http.MethodPost, Path: "/user"})
+	handler, err := NewHTTPHandler(r)
+	if err != nil {
+		panic(err)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPHandler(t *testing.T) {
+	server := newTestHTTPServer(t)
+	cases := []struct {
+		method     string
+		path       string
+		body       string
+		httpStatus int
+		want       string
+	}{
+		{http.MethodGet, "/user?id=1", "", http.StatusOK, `{"id":1,"token":"abc"}`},
+		{http.MethodGet, "/user?id=a", "", http.StatusBadRequest, `"type":"invalid_type"`},
+		{http.MethodGet, "/user", "", http.StatusBadRequest, `"type":"required"`},
+		{http.MethodPost, "/user", `{"name":"张三"}`, http.StatusOK, `{"name":"张三"}`},
+		{http.MethodPost, "/user", `{"name":"admin"}`, http.StatusForbidden, `{"code":"20001","message":"forbidden"}`},
+		{http.MethodPost, "/user", `["admin"]`, http.StatusBadRequest, `"type":"invalid_json"`},
+		{http.MethodDelete, "/user", "", http.StatusMethodNotAllowed, `"code":"405"`},
+		{http.MethodGet, "/none", "", http.StatusNotFound, `"code":"404"`},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest(c.method, server.URL+c.path, strings.NewReader(c.body))
+		if err != nil {
+			panic(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Token", "abc")
+		rsp, err := server.Client().Do(req)
+		if err != nil {
+			panic(err)
+		}
+		body, err := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(c.method, c.path, rsp.StatusCode, string(body))
+		if rsp.StatusCode != c.httpStatus || !strings.Contains(string(body), c.want) {
+			t.Errorf("%s %s got %d %s, want %d %s", c.method, c.path, rsp.StatusCode, body, c.httpStatus, c.want)
+		}
+	}
+}
+
+func TestHTTPHandlerMaxBodySize(t *testing.T) {
+	r := NewRepository()
+	r.AddTemplateByStr("createUser", `{"name":"{{.name}}"}`)
+	r.RegisterMeta("createUser", &TemplateMeta{Name: "createUser", Method: http.MethodPost, Path: "/user"})
+	handler, err := NewHTTPHandler(r, WithMaxBodySize(16))
+	if err != nil {
+		panic(err)
+	}
+	for body, httpStatus := range map[string]int{`{"name":"a"}`: http.StatusOK, `{"name":"abcdefghijklmn"}`: http.StatusRequestEntityTooLarge} {
+		req := httptest.NewRequest(http.MethodPost, "/user", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != httpStatus {
+			t.Errorf("%s got %d %s, want %d", body, w.Code, w.Body.String(), httpStatus)
+		}
+	}
+}
+
+func TestNewHTTPHandlerConflict(t *testing.T) {
+	r := NewRepository()
+	r.RegisterMeta("a", &TemplateMeta{Method: "get", Path: "/a"})
+	r.RegisterMeta("b", &TemplateMeta{Method: http.MethodGet, Path: "/a"})
+	if _, err := NewHTTPHandler(r); err == nil {
+		t.Error("expected route conflict error")
+	}
+}
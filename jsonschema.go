@@ -86,6 +86,7 @@ type Schema struct {
 	// json schema 生成的json data 路径
 	DataPath    string `json:"-"`
 	DataPathSrc string `json:"src,omitempty"`
+	Dst         string `json:"dst,omitempty"`      // 输入数据写入容器的路径
 	Transfer    string `json:"transfer,omitempty"` // 数据转换表达式
 	// 是否容许为空
 	AllowEmpty bool `json:"allowEmpty,omitempty"`
@@ -438,6 +439,36 @@ func (schema *Schema) GetTransferPaths() TransferPaths {
 	return out.UniqueItems().Valid()
 }
 
+// GetInputTransferPaths 输入数据的路径映射，Src 为输入 json 路径，Dst 为设置了 dst 的容器路径
+func (schema *Schema) GetInputTransferPaths() TransferPaths {
+	schema.Init()
+	return schema.getInputTransferPaths()
+}
+
+func (schema *Schema) getInputTransferPaths() TransferPaths {
+	out := make(TransferPaths, 0)
+	if schema.Dst != "" {
+		typ, _ := schema.Type()
+		out = append(out, &TransferPath{
+			Src:        TrimDot(schema.DataPath),
+			SrcType:    typ,
+			Dst:        schema.Dst,
+			DstType:    typ,
+			Default:    schema.Default,
+			AllowEmpty: schema.AllowEmpty,
+			Transfer:   schema.Transfer,
+			Schema:     schema,
+		})
+	}
+	for _, p := range schema.Properties {
+		out = append(out, p.getInputTransferPaths()...)
+	}
+	if schema.Items != nil {
+		out = append(out, schema.Items.getInputTransferPaths()...)
+	}
+	return out
+}
+
 func (schema *Schema) updatePathElements() {
 	if schema.IsRoot() {
 		schema.PathElement = "#"
@@ -0,0 +1,524 @@
+package templatemap
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/templatemap/provider"
+	"github.com/suifengpiao14/templatemap/util"
+	"github.com/tidwall/sjson"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const (
+	LINESCHEMA_DIRECTION_IN  = "in"  // 输入数据，dst 为写入容器的路径
+	LINESCHEMA_DIRECTION_OUT = "out" // 输出数据，src 为从容器读取的路径
+)
+
+const lineschemaArraySuffix = "[]"
+
+// LineschemaHeader lineschema 首行元信息，如: version=http://json-schema.org/draft-07/schema#,id=paginate,direction=in
+type LineschemaHeader struct {
+	Version   string
+	ID        string
+	Direction string
+}
+
+// LineschemaItem lineschema 中的一行，描述一个属性，如: fullname=a.b[].c,type=string,format=phone,required,dst=A.B.#.C
+// fullname 中 [] 表示数组，最后一段为数组时 type、format、pattern、default 描述数组元素，其余描述数组本身
+type LineschemaItem struct {
+	Fullname    string
+	Type        string
+	Format      string
+	Pattern     string
+	Title       string
+	Description string
+	Default     string // 为空时表示没有默认值
+	Required    bool
+	AllowEmpty  bool
+	Dst         string
+	Src         string
+	Transfer    string
+}
+
+// Lineschema 自定义的元数据格式，每行一个属性，逗号分隔键值(值中的逗号使用 \, 转义)，可与 json schema 相互转换
+type Lineschema struct {
+	Header LineschemaHeader
+	Items  []*LineschemaItem
+}
+
+// ParseLineschema 解析 lineschema 文本，首行不含 fullname 时作为元信息行
+func ParseLineschema(lineschema string) (*Lineschema, error) {
+	l := &Lineschema{Items: make([]*LineschemaItem, 0)}
+	lineschema = strings.ReplaceAll(util.TrimSpaces(lineschema), provider.WINDOW_EOF, provider.EOF)
+	first := true
+	for _, line := range strings.Split(lineschema, provider.EOF) {
+		line = util.TrimSpaces(line)
+		if line == "" {
+			continue
+		}
+		kvs, err := parseLineschemaLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := kvs["fullname"]; !ok && first {
+			first = false
+			err = l.Header.set(kvs)
+			if err != nil {
+				err = errors.WithMessagef(err, "lineschema line: %s", line)
+				return nil, err
+			}
+			continue
+		}
+		first = false
+		item := &LineschemaItem{}
+		err = item.set(kvs)
+		if err != nil {
+			err = errors.WithMessagef(err, "lineschema line: %s", line)
+			return nil, err
+		}
+		l.Items = append(l.Items, item)
+	}
+	return l, nil
+}
+
+func parseLineschemaLine(line string) (map[string]string, error) {
+	kvs := make(map[string]string)
+	for _, pair := range splitLineschemaLine(line) {
+		pair = util.TrimSpaces(pair)
+		if pair == "" {
+			continue
+		}
+		key, value := pair, ""
+		if i := strings.Index(pair, "="); i > -1 {
+			key, value = util.TrimSpaces(pair[:i]), pair[i+1:]
+		} else {
+			value = "true" // 只有键时为布尔属性，如 required
+		}
+		if _, ok := kvs[key]; ok {
+			err := errors.Errorf("duplicate key %s", key)
+			return nil, err
+		}
+		kvs[key] = value
+	}
+	return kvs, nil
+}
+
+// splitLineschemaLine 按逗号分隔，\, 为值中的逗号
+func splitLineschemaLine(line string) []string {
+	parts := make([]string, 0)
+	var b strings.Builder
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\\' && i+1 < len(runes) && runes[i+1] == ',' {
+			b.WriteRune(',')
+			i++
+			continue
+		}
+		if r == ',' {
+			parts = append(parts, b.String())
+			b.Reset()
+			continue
+		}
+		b.WriteRune(r)
+	}
+	parts = append(parts, b.String())
+	return parts
+}
+
+func (h *LineschemaHeader) set(kvs map[string]string) error {
+	for key, value := range kvs {
+		switch key {
+		case "version":
+			h.Version = value
+		case "id":
+			h.ID = value
+		case "direction":
+			if value != LINESCHEMA_DIRECTION_IN && value != LINESCHEMA_DIRECTION_OUT {
+				err := errors.Errorf("direction want %s or %s, got %s", LINESCHEMA_DIRECTION_IN, LINESCHEMA_DIRECTION_OUT, value)
+				return err
+			}
+			h.Direction = value
+		default:
+			err := errors.Errorf("unknown header key %s", key)
+			return err
+		}
+	}
+	return nil
+}
+
+func (item *LineschemaItem) set(kvs map[string]string) (err error) {
+	for key, value := range kvs {
+		switch key {
+		case "fullname":
+			item.Fullname = value
+		case "type":
+			item.Type = value
+		case "format":
+			item.Format = value
+		case "pattern":
+			item.Pattern = value
+		case "title":
+			item.Title = value
+		case "description":
+			item.Description = value
+		case "default":
+			item.Default = value
+		case "required":
+			item.Required, err = strconv.ParseBool(value)
+		case "allowEmpty":
+			item.AllowEmpty, err = strconv.ParseBool(value)
+		case "dst":
+			item.Dst = value
+		case "src":
+			item.Src = value
+		case "transfer":
+			item.Transfer = value
+		default:
+			err = errors.Errorf("unknown key %s", key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if item.Fullname == "" {
+		err = errors.Errorf("fullname required")
+		return err
+	}
+	if item.Type == "" {
+		item.Type = "string"
+	}
+	return nil
+}
+
+func (h LineschemaHeader) String() string {
+	kvs := make([]string, 0)
+	for _, kv := range [][2]string{{"version", h.Version}, {"id", h.ID}, {"direction", h.Direction}} {
+		if kv[1] != "" {
+			kvs = append(kvs, kv[0]+"="+escapeLineschemaValue(kv[1]))
+		}
+	}
+	return strings.Join(kvs, ",")
+}
+
+func (item LineschemaItem) String() string {
+	kvs := make([]string, 0)
+	for _, kv := range [][2]string{
+		{"fullname", item.Fullname},
+		{"type", item.Type},
+		{"format", item.Format},
+		{"pattern", item.Pattern},
+		{"title", item.Title},
+		{"description", item.Description},
+		{"default", item.Default},
+	} {
+		if kv[1] != "" {
+			kvs = append(kvs, kv[0]+"="+escapeLineschemaValue(kv[1]))
+		}
+	}
+	if item.Required {
+		kvs = append(kvs, "required")
+	}
+	if item.AllowEmpty {
+		kvs = append(kvs, "allowEmpty")
+	}
+	for _, kv := range [][2]string{{"dst", item.Dst}, {"src", item.Src}, {"transfer", item.Transfer}} {
+		if kv[1] != "" {
+			kvs = append(kvs, kv[0]+"="+escapeLineschemaValue(kv[1]))
+		}
+	}
+	return strings.Join(kvs, ",")
+}
+
+func escapeLineschemaValue(value string) string {
+	return strings.ReplaceAll(value, ",", `\,`)
+}
+
+// String 输出 lineschema 文本，ParseLineschema 解析后结果不变
+func (l *Lineschema) String() string {
+	lines := make([]string, 0, len(l.Items)+1)
+	if header := l.Header.String(); header != "" {
+		lines = append(lines, header)
+	}
+	for _, item := range l.Items {
+		lines = append(lines, item.String())
+	}
+	return strings.Join(lines, provider.EOF)
+}
+
+// JsonSchema 转换为 json schema，根节点为 object，路径中间节点不存在时自动创建
+func (l *Lineschema) JsonSchema() (*Schema, error) {
+	root := &Schema{
+		SchemaType: l.Header.Version,
+		ID06:       l.Header.ID,
+		TypeValue:  "object",
+	}
+	for _, item := range l.Items {
+		err := root.addLineschemaItem(item)
+		if err != nil {
+			err = errors.WithMessagef(err, "fullname %s", item.Fullname)
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+// JsonSchemaString 转换为 json schema 字符串
+func (l *Lineschema) JsonSchemaString() (string, error) {
+	schema, err := l.JsonSchema()
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// DefaultJson 由默认值组成的 json 对象，数组元素的默认值不参与
+func (l *Lineschema) DefaultJson() (string, error) {
+	out := "{}"
+	for _, item := range l.Items {
+		if item.Default == "" || strings.Contains(item.Fullname, lineschemaArraySuffix) {
+			continue
+		}
+		value, err := lineschemaDefaultValue(item.Type, item.Default)
+		if err != nil {
+			err = errors.WithMessagef(err, "fullname %s", item.Fullname)
+			return "", err
+		}
+		out, err = sjson.Set(out, item.Fullname, value)
+		if err != nil {
+			return "", err
+		}
+	}
+	return out, nil
+}
+
+func lineschemaDefaultValue(typ string, raw string) (value interface{}, err error) {
+	switch typ {
+	case "integer":
+		value, err = strconv.ParseInt(raw, 10, 64)
+	case "number":
+		value, err = strconv.ParseFloat(raw, 64)
+	case "boolean":
+		value, err = strconv.ParseBool(raw)
+	case "array", "object":
+		err = json.Unmarshal([]byte(raw), &value)
+	default:
+		value = raw
+	}
+	if err != nil {
+		err = errors.WithMessagef(err, "default %s can`t convert to %s", raw, typ)
+		return nil, err
+	}
+	return value, nil
+}
+
+func splitLineschemaName(segment string) (name string, isArray bool) {
+	if strings.HasSuffix(segment, lineschemaArraySuffix) {
+		return strings.TrimSuffix(segment, lineschemaArraySuffix), true
+	}
+	return segment, false
+}
+
+// lineschemaProperty 获取属性，不存在时创建
+func (schema *Schema) lineschemaProperty(name string, isArray bool) (*Schema, error) {
+	if typ, _ := schema.Type(); typ != "object" {
+		err := errors.Errorf("parent of %s type want object, got %s", name, typ)
+		return nil, err
+	}
+	if schema.Properties == nil {
+		schema.Properties = make(map[string]*Schema)
+	}
+	property, ok := schema.Properties[name]
+	if !ok {
+		property = &Schema{TypeValue: "object"}
+		if isArray {
+			property.TypeValue = "array"
+		}
+		schema.Properties[name] = property
+	}
+	if isArray {
+		if typ, _ := property.Type(); typ != "array" {
+			err := errors.Errorf("%s type want array, got %s", name, typ)
+			return nil, err
+		}
+		if property.Items == nil {
+			property.Items = &Schema{TypeValue: "object"}
+		}
+	}
+	return property, nil
+}
+
+func (schema *Schema) addLineschemaItem(item *LineschemaItem) error {
+	segments := strings.Split(item.Fullname, ".")
+	parent := schema
+	for _, segment := range segments[:len(segments)-1] {
+		name, isArray := splitLineschemaName(segment)
+		property, err := parent.lineschemaProperty(name, isArray)
+		if err != nil {
+			return err
+		}
+		parent = property
+		if isArray {
+			parent = property.Items
+		}
+	}
+	name, isArray := splitLineschemaName(segments[len(segments)-1])
+	if !isArray && item.Type == "array" {
+		isArray = true // 未声明元素类型的数组
+	}
+	property, err := parent.lineschemaProperty(name, isArray)
+	if err != nil {
+		return err
+	}
+	value := property
+	if strings.HasSuffix(item.Fullname, lineschemaArraySuffix) {
+		value = property.Items
+	} else if item.Type == "array" {
+		property.Items = nil
+	}
+	if len(value.Properties) > 0 && item.Type != "object" {
+		err = errors.Errorf("type want object, got %s", item.Type)
+		return err
+	}
+	value.TypeValue = item.Type
+	value.Format = item.Format
+	value.Pattern = item.Pattern
+	if item.Default != "" {
+		value.Default, err = lineschemaDefaultValue(item.Type, item.Default)
+		if err != nil {
+			return err
+		}
+	}
+	property.Title = item.Title
+	property.Description = item.Description
+	property.AllowEmpty = item.AllowEmpty
+	property.Dst = item.Dst
+	property.DataPathSrc = item.Src
+	property.Transfer = item.Transfer
+	if item.Required && !IsRequired(parent.Required, name) {
+		parent.Required = append(parent.Required, name)
+	}
+	return nil
+}
+
+// JsonSchema2Lineschema json schema 转换为 lineschema，属性按名称排序，仅有类型的中间 object 节点省略；
+// json schema 中没有 direction，根据是否存在 dst/src 推断
+func JsonSchema2Lineschema(jsonSchema string) (*Lineschema, error) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(jsonSchema), schema)
+	if err != nil {
+		err = errors.WithMessage(err, "JsonSchema2Lineschema")
+		return nil, err
+	}
+	l := &Lineschema{
+		Header: LineschemaHeader{
+			Version: schema.SchemaType,
+			ID:      schema.ID(),
+		},
+		Items: make([]*LineschemaItem, 0),
+	}
+	err = l.addSchemaItems(schema, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range l.Items {
+		if item.Dst != "" {
+			l.Header.Direction = LINESCHEMA_DIRECTION_IN
+			break
+		}
+		if item.Src != "" {
+			l.Header.Direction = LINESCHEMA_DIRECTION_OUT
+		}
+	}
+	return l, nil
+}
+
+func (l *Lineschema) addSchemaItems(schema *Schema, prefix string) error {
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property := schema.Properties[name]
+		fullname := name
+		if prefix != "" {
+			fullname = prefix + "." + name
+		}
+		typ, _ := property.Type()
+		value := property
+		if typ == "array" && property.Items != nil {
+			fullname += lineschemaArraySuffix
+			value = property.Items
+			typ, _ = value.Type()
+		}
+		item := &LineschemaItem{
+			Fullname:    fullname,
+			Type:        typ,
+			Format:      value.Format,
+			Pattern:     value.Pattern,
+			Title:       property.Title,
+			Description: property.Description,
+			Required:    IsRequired(schema.Required, name),
+			AllowEmpty:  property.AllowEmpty,
+			Dst:         property.Dst,
+			Src:         property.DataPathSrc,
+			Transfer:    property.Transfer,
+		}
+		if value.Default != nil {
+			if str, ok := value.Default.(string); ok {
+				item.Default = str
+			} else {
+				b, err := json.Marshal(value.Default)
+				if err != nil {
+					return err
+				}
+				item.Default = string(b)
+			}
+		}
+		if typ == "object" && len(value.Properties) > 0 {
+			if *item != (LineschemaItem{Fullname: fullname, Type: typ}) {
+				l.Items = append(l.Items, item)
+			}
+			err := l.addSchemaItems(value, fullname)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		l.Items = append(l.Items, item)
+	}
+	return nil
+}
+
+// NewLineschemaMeta 解析 lineschema，生成 json schema、默认值及校验器
+func NewLineschemaMeta(lineschema string) (*LineschemaMeta, error) {
+	l, err := ParseLineschema(lineschema)
+	if err != nil {
+		return nil, err
+	}
+	jsonSchema, err := l.JsonSchemaString()
+	if err != nil {
+		return nil, err
+	}
+	defaultJson, err := l.DefaultJson()
+	if err != nil {
+		return nil, err
+	}
+	schemaLoader := gojsonschema.NewStringLoader(jsonSchema)
+	meta := &LineschemaMeta{
+		Lineschema:   lineschema,
+		JsonSchema:   jsonSchema,
+		DefaultJson:  defaultJson,
+		SchemaLoader: &schemaLoader,
+	}
+	return meta, nil
+}
@@ -0,0 +1,83 @@
+package templatemap
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/suifengpiao14/templatemap/util"
+)
+
+const paginateLineschema = `version=http://json-schema.org/draft-07/schema#,id=paginate,direction=in
+fullname=name,type=string,title=名称,description=名称\,模糊匹配,dst=Name
+fullname=pageIndex,type=integer,default=0,required,dst=PageIndex
+fullname=pageSize,type=integer,default=20,required,dst=PageSize
+fullname=tags[],type=string,dst=Tags
+fullname=where,type=object,description=筛选条件,required
+fullname=where.ids[],type=integer,dst=IDs
+fullname=where.status,type=string,pattern=^\d+$,allowEmpty,dst=Status
+fullname=where.users[].phone,type=string,format=phone,required,dst=Users.#.phone`
+
+func TestLineschemaRoundTrip(t *testing.T) {
+	l, err := ParseLineschema(paginateLineschema)
+	if err != nil {
+		panic(err)
+	}
+	if out := l.String(); out != paginateLineschema {
+		t.Errorf("lineschema got:\n%s\nwant:\n%s", out, paginateLineschema)
+	}
+	jsonSchema, err := l.JsonSchemaString()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(jsonSchema)
+	schema := NewJsonSchema(jsonSchema)
+	if schema.Properties["where"].Properties["users"].Items.Required[0] != "phone" {
+		t.Errorf("where.users[].phone not required: %s", jsonSchema)
+	}
+	if schema.Properties["pageSize"].Dst != "PageSize" {
+		t.Errorf("pageSize dst lost: %s", jsonSchema)
+	}
+	back, err := JsonSchema2Lineschema(jsonSchema)
+	if err != nil {
+		panic(err)
+	}
+	if out := back.String(); out != paginateLineschema {
+		t.Errorf("json schema to lineschema got:\n%s\nwant:\n%s", out, paginateLineschema)
+	}
+}
+
+func TestNewLineschemaMeta(t *testing.T) {
+	meta, err := NewLineschemaMeta(paginateLineschema)
+	if err != nil {
+		panic(err)
+	}
+	if want := `{"pageIndex":0,"pageSize":20}`; meta.DefaultJson != want {
+		t.Errorf("DefaultJson got %s, want %s", meta.DefaultJson, want)
+	}
+	valid := `{"pageIndex":1,"pageSize":20,"where":{"status":"1","users":[{"phone":"13800138000"}]}}`
+	if err = util.Validate(valid, *meta.SchemaLoader); err != nil {
+		t.Error(err)
+	}
+	invalid := `{"pageIndex":"1","pageSize":20,"where":{"users":[{}]}}`
+	if err = util.Validate(invalid, *meta.SchemaLoader); err == nil {
+		t.Errorf("expected validate error: %s", invalid)
+	}
+}
+
+func TestParseLineschemaError(t *testing.T) {
+	for _, lineschema := range []string{
+		"fullname=a,type=string,unknown=1",
+		"fullname=a,type=string\nfullname=a.b,type=string",
+		"fullname=a,type=integer,default=abc",
+		"version=v1,direction=both",
+		"type=string",
+	} {
+		l, err := ParseLineschema(lineschema)
+		if err == nil {
+			_, err = l.JsonSchema()
+		}
+		if err == nil {
+			t.Errorf("expected error: %s", lineschema)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package provider
 
 import (
+	"context"
 	"encoding/json"
+	"sort"
+	"sync"
 
 	"github.com/pkg/errors"
 )
@@ -19,37 +22,95 @@ type ExecproviderInterface interface {
 	GetSource() (source interface{})
 }
 
-//MakeExecProvider 根据名称，获取exec 执行器，后续改成注册执行器方式
-func MakeExecProvider(identifier string, configJson string) (execProvider ExecproviderInterface, err error) {
+// ExecproviderContextInterface 支持上下文的执行器，调用方的取消、超时及请求级数据通过 ctx 传递到底层调用
+type ExecproviderContextInterface interface {
+	ExecproviderInterface
+	ExecContext(ctx context.Context, identifier string, s string) (string, error)
+}
+
+// SQLExecproviderInterface 参数化执行 SQL，语句与参数分开传递给数据库，不在 SQL 文本中拼接参数值
+type SQLExecproviderInterface interface {
+	ExecproviderInterface
+	ExecSQL(ctx context.Context, identifier string, statement string, args ...interface{}) (string, error)
+}
+
+// ExecWithContext 执行器实现 ExecproviderContextInterface 时传递 ctx，否则在 ctx 未结束时调用 Exec
+func ExecWithContext(ctx context.Context, execProvider ExecproviderInterface, identifier string, s string) (string, error) {
+	if ctxProvider, ok := execProvider.(ExecproviderContextInterface); ok {
+		return ctxProvider.ExecContext(ctx, identifier, s)
+	}
+	if err := ctx.Err(); err != nil {
+		err = errors.WithMessagef(err, "exec %s", identifier)
+		return "", err
+	}
+	return execProvider.Exec(identifier, s)
+}
+
+// ExecProviderFactory 根据 json 配置创建执行器，配置由各执行器自行解析
+type ExecProviderFactory func(configJson string) (ExecproviderInterface, error)
+
+var (
+	factoryLock sync.RWMutex
+	factoryMap  = make(map[string]ExecProviderFactory)
+)
+
+// Register 注册执行器类型，identifier 重复注册返回错误
+func Register(identifier string, factory ExecProviderFactory) error {
+	if factory == nil {
+		err := errors.Errorf("provider %s factory is nil", identifier)
+		return err
+	}
+	factoryLock.Lock()
+	defer factoryLock.Unlock()
+	if _, ok := factoryMap[identifier]; ok {
+		err := errors.Errorf("provider %s already registered", identifier)
+		return err
+	}
+	factoryMap[identifier] = factory
+	return nil
+}
 
-	switch identifier {
-	case PROVIDER_SQL:
-		var config DBExecProviderConfig
-		if configJson != "" {
-			err = json.Unmarshal([]byte(configJson), &config)
-			if err != nil {
-				return nil, err
-			}
-		}
-		execProvider = &DBExecProvider{
-			Config: config,
-		}
-	case PROVIDER_CURL:
-		var config CURLExecProviderConfig
-		if configJson != "" {
-			err = json.Unmarshal([]byte(configJson), &config)
-			if err != nil {
-				return nil, err
-			}
-		}
-		execProvider = &CURLExecProvider{
-			Config: config,
-		}
-	case PROVIDER_BIN:
-		execProvider = &BinExecProvider{}
-	default:
+// MustRegister 同 Register，出错时 panic，用于 init 函数中注册
+func MustRegister(identifier string, factory ExecProviderFactory) {
+	err := Register(identifier, factory)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Providers 返回已注册的执行器类型(按名称排序)
+func Providers() []string {
+	factoryLock.RLock()
+	defer factoryLock.RUnlock()
+	out := make([]string, 0, len(factoryMap))
+	for identifier := range factoryMap {
+		out = append(out, identifier)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// DecodeConfig 解析 json 配置，configJson 为空时保持 config 零值
+func DecodeConfig(configJson string, config interface{}) error {
+	if configJson == "" {
+		return nil
+	}
+	err := json.Unmarshal([]byte(configJson), config)
+	if err != nil {
+		err = errors.WithMessage(err, "decode provider config")
+		return err
+	}
+	return nil
+}
+
+//MakeExecProvider 根据名称，获取已注册的 exec 执行器
+func MakeExecProvider(identifier string, configJson string) (execProvider ExecproviderInterface, err error) {
+	factoryLock.RLock()
+	factory, ok := factoryMap[identifier]
+	factoryLock.RUnlock()
+	if !ok {
 		err = errors.Errorf("not suport source type :%s", identifier)
 		return nil, err
 	}
-	return execProvider, nil
+	return factory(configJson)
 }
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"context"
+	"sync"
+)
+
+// CaptureRecord 一次执行器调用，Input 为模板渲染结果，SQL 模板为拼接参数后的 SQL(同容器中 <name>SQL)
+type CaptureRecord struct {
+	Identifier string `json:"identifier"`
+	Input      string `json:"input"`
+}
+
+// CaptureExecProvider 记录执行器调用而不执行，按模板名称从 Fixtures 返回预设输出(不存在时返回空字符串)，用于预览生成的 SQL/HTTP/命令
+type CaptureExecProvider struct {
+	Fixtures map[string]string
+	lock     sync.Mutex
+	records  []CaptureRecord
+}
+
+func NewCaptureExecProvider(fixtures map[string]string) *CaptureExecProvider {
+	return &CaptureExecProvider{Fixtures: fixtures}
+}
+
+func (p *CaptureExecProvider) Exec(identifier string, s string) (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.records = append(p.records, CaptureRecord{Identifier: identifier, Input: s})
+	return p.Fixtures[identifier], nil
+}
+
+func (p *CaptureExecProvider) GetSource() (source interface{}) {
+	return nil
+}
+
+// Records 已记录的调用(按调用顺序)
+func (p *CaptureExecProvider) Records() []CaptureRecord {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	out := make([]CaptureRecord, len(p.records))
+	copy(out, p.records)
+	return out
+}
+
+// Reset 清空记录
+func (p *CaptureExecProvider) Reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.records = nil
+}
+
+// Wrap 返回替换 execProvider 的记录执行器，execProvider 为 SQL 执行器时保留 SQLExecproviderInterface，模板仍按 SQL 渲染
+func (p *CaptureExecProvider) Wrap(execProvider ExecproviderInterface) ExecproviderInterface {
+	if _, ok := execProvider.(SQLExecproviderInterface); ok {
+		return &captureSQLExecProvider{CaptureExecProvider: p, dialect: DialectOf(execProvider)}
+	}
+	return p
+}
+
+type captureSQLExecProvider struct {
+	*CaptureExecProvider
+	dialect SQLDialect
+}
+
+func (p *captureSQLExecProvider) ExecSQL(ctx context.Context, identifier string, statement string, args ...interface{}) (string, error) {
+	return p.Exec(identifier, p.dialect.ExplainSQL(statement, args...))
+}
+
+func (p *captureSQLExecProvider) GetDialect() SQLDialect {
+	return p.dialect
+}
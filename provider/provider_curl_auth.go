@@ -0,0 +1,359 @@
+package provider
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	AUTH_BEARER = "bearer"
+	AUTH_BASIC  = "basic"
+	AUTH_OAUTH2 = "oauth2"
+	AUTH_HMAC   = "hmac"
+)
+
+// AuthConfig CURL 执行器的认证配置，Type 为 RegisterAuth 注册的名称，Config 由认证方式自行解析
+type AuthConfig struct {
+	Type   string          `json:"type"`
+	Config json.RawMessage `json:"config"`
+}
+
+// AuthInterface 请求发送前(包括每次重试)设置认证信息，client 为执行器的 http 客户端，body 为最终发送的请求体
+type AuthInterface interface {
+	Apply(ctx context.Context, client *http.Client, req *http.Request, body []byte) error
+}
+
+// AuthInvalidator 响应 401 时清除缓存的凭证，下次请求重新获取
+type AuthInvalidator interface {
+	Invalidate()
+}
+
+// AuthFactory 根据 json 配置创建认证方式
+type AuthFactory func(configJson string) (AuthInterface, error)
+
+var (
+	authLock       sync.RWMutex
+	authFactoryMap = make(map[string]AuthFactory)
+)
+
+// RegisterAuth 注册认证方式，name 重复注册返回错误
+func RegisterAuth(name string, factory AuthFactory) error {
+	if factory == nil {
+		err := errors.Errorf("auth %s factory is nil", name)
+		return err
+	}
+	authLock.Lock()
+	defer authLock.Unlock()
+	if _, ok := authFactoryMap[name]; ok {
+		err := errors.Errorf("auth %s already registered", name)
+		return err
+	}
+	authFactoryMap[name] = factory
+	return nil
+}
+
+// MustRegisterAuth 注册失败时 panic，用于 init
+func MustRegisterAuth(name string, factory AuthFactory) {
+	if err := RegisterAuth(name, factory); err != nil {
+		panic(err)
+	}
+}
+
+// MakeAuth 根据名称创建已注册的认证方式
+func MakeAuth(name string, configJson string) (AuthInterface, error) {
+	authLock.RLock()
+	factory, ok := authFactoryMap[name]
+	authLock.RUnlock()
+	if !ok {
+		err := errors.Errorf("not suport auth type :%s", name)
+		return nil, err
+	}
+	return factory(configJson)
+}
+
+func init() {
+	MustRegisterAuth(AUTH_BEARER, func(configJson string) (AuthInterface, error) {
+		auth := &BearerAuth{}
+		err := decodeAuthConfig(configJson, auth)
+		if err != nil {
+			return nil, err
+		}
+		if auth.Token == "" {
+			err = errors.Errorf("bearer auth token required")
+			return nil, err
+		}
+		return auth, nil
+	})
+	MustRegisterAuth(AUTH_BASIC, func(configJson string) (AuthInterface, error) {
+		auth := &BasicAuth{}
+		err := decodeAuthConfig(configJson, auth)
+		if err != nil {
+			return nil, err
+		}
+		return auth, nil
+	})
+	MustRegisterAuth(AUTH_OAUTH2, func(configJson string) (AuthInterface, error) {
+		auth := &OAuth2Auth{}
+		err := decodeAuthConfig(configJson, auth)
+		if err != nil {
+			return nil, err
+		}
+		if auth.TokenURL == "" || auth.ClientID == "" {
+			err = errors.Errorf("oauth2 auth tokenURL and clientID required")
+			return nil, err
+		}
+		return auth, nil
+	})
+	MustRegisterAuth(AUTH_HMAC, func(configJson string) (AuthInterface, error) {
+		auth := &HMACAuth{}
+		err := decodeAuthConfig(configJson, auth)
+		if err != nil {
+			return nil, err
+		}
+		if auth.Secret == "" {
+			err = errors.Errorf("hmac auth secret required")
+			return nil, err
+		}
+		if _, err = auth.hashFunc(); err != nil {
+			return nil, err
+		}
+		return auth, nil
+	})
+}
+
+func decodeAuthConfig(configJson string, config interface{}) error {
+	err := DecodeConfig(configJson, config)
+	if err != nil {
+		err = errors.WithMessage(err, "decode auth config")
+		return err
+	}
+	return nil
+}
+
+// BearerAuth 固定 token，设置 Authorization: Bearer <token>
+type BearerAuth struct {
+	Token string `json:"token"`
+}
+
+func (a *BearerAuth) Apply(ctx context.Context, client *http.Client, req *http.Request, body []byte) error {
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+// BasicAuth http basic 认证
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (a *BasicAuth) Apply(ctx context.Context, client *http.Client, req *http.Request, body []byte) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// OAuth2Auth client credentials 模式，token 缓存到过期前 ExpiryDelta(秒，默认 10)，过期后存在 refresh_token 时优先刷新，失败再重新获取；
+// ClientSecret 默认通过 basic 认证发送，AuthStyle 为 params 时放在请求体中
+type OAuth2Auth struct {
+	TokenURL     string   `json:"tokenURL"`
+	ClientID     string   `json:"clientID"`
+	ClientSecret string   `json:"clientSecret"`
+	Scopes       []string `json:"scopes"`
+	AuthStyle    string   `json:"authStyle"`
+	ExpiryDelta  int      `json:"expiryDelta"`
+	lock         sync.Mutex
+	token        *oauth2Token
+}
+
+type oauth2Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	expiry       time.Time
+}
+
+func (t *oauth2Token) valid() bool {
+	return t != nil && t.AccessToken != "" && (t.expiry.IsZero() || time.Now().Before(t.expiry))
+}
+
+func (a *OAuth2Auth) Apply(ctx context.Context, client *http.Client, req *http.Request, body []byte) error {
+	token, err := a.getToken(ctx, client)
+	if err != nil {
+		return err
+	}
+	tokenType := token.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	req.Header.Set("Authorization", tokenType+" "+token.AccessToken)
+	return nil
+}
+
+// Invalidate 清除缓存的 token
+func (a *OAuth2Auth) Invalidate() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.token = nil
+}
+
+func (a *OAuth2Auth) getToken(ctx context.Context, client *http.Client) (*oauth2Token, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.token.valid() {
+		return a.token, nil
+	}
+	var token *oauth2Token
+	var err error
+	if a.token != nil && a.token.RefreshToken != "" {
+		token, err = a.requestToken(ctx, client, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {a.token.RefreshToken}})
+	}
+	if token == nil {
+		params := url.Values{"grant_type": {"client_credentials"}}
+		if len(a.Scopes) > 0 {
+			params.Set("scope", strings.Join(a.Scopes, " "))
+		}
+		token, err = a.requestToken(ctx, client, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.token = token
+	return token, nil
+}
+
+func (a *OAuth2Auth) requestToken(ctx context.Context, client *http.Client, params url.Values) (*oauth2Token, error) {
+	if a.AuthStyle == "params" {
+		params.Set("client_id", a.ClientID)
+		params.Set("client_secret", a.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.TokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", CONTENT_TYPE_FORM)
+	req.Header.Set("Accept", "application/json")
+	if a.AuthStyle != "params" {
+		req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		err = errors.Errorf("oauth2 token response httpstatus:%d, body: %s", rsp.StatusCode, string(b))
+		return nil, err
+	}
+	token := &oauth2Token{}
+	err = json.Unmarshal(b, token)
+	if err != nil {
+		err = errors.WithMessage(err, "oauth2 token response")
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		err = errors.Errorf("oauth2 token response without access_token: %s", string(b))
+		return nil, err
+	}
+	if token.ExpiresIn > 0 {
+		delta := a.ExpiryDelta
+		if delta <= 0 {
+			delta = 10
+		}
+		token.expiry = time.Now().Add(time.Duration(token.ExpiresIn-int64(delta)) * time.Second)
+	}
+	return token, nil
+}
+
+// HMACAuth 请求签名，签名内容为 "<METHOD>\n<path(含查询参数)>\n<timestamp>\n<hex(sha256(body))>"，
+// 签名为 base64(hmac(secret, 签名内容))，设置请求头 TimestampHeader(默认 X-Timestamp，unix 秒) 及 Authorization: <Algorithm 大写> <KeyID>:<签名>
+type HMACAuth struct {
+	KeyID           string `json:"keyID"`
+	Secret          string `json:"secret"`
+	Algorithm       string `json:"algorithm"` // hmac-sha256(默认)、hmac-sha1、hmac-sha512
+	TimestampHeader string `json:"timestampHeader"`
+}
+
+func (a *HMACAuth) hashFunc() (func() hash.Hash, error) {
+	switch strings.ToLower(a.Algorithm) {
+	case "", "hmac-sha256":
+		return sha256.New, nil
+	case "hmac-sha1":
+		return sha1.New, nil
+	case "hmac-sha512":
+		return sha512.New, nil
+	}
+	err := errors.Errorf("hmac auth algorithm %s not supported", a.Algorithm)
+	return nil, err
+}
+
+func (a *HMACAuth) Apply(ctx context.Context, client *http.Client, req *http.Request, body []byte) error {
+	hashFunc, err := a.hashFunc()
+	if err != nil {
+		return err
+	}
+	algorithm := a.Algorithm
+	if algorithm == "" {
+		algorithm = "hmac-sha256"
+	}
+	timestampHeader := a.TimestampHeader
+	if timestampHeader == "" {
+		timestampHeader = "X-Timestamp"
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := a.Sign(hashFunc, req.Method, req.URL.RequestURI(), timestamp, body)
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set("Authorization", strings.ToUpper(algorithm)+" "+a.KeyID+":"+signature)
+	return nil
+}
+
+// Sign 计算签名，服务端可使用相同方法校验
+func (a *HMACAuth) Sign(hashFunc func() hash.Hash, method string, path string, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	content := strings.Join([]string{strings.ToUpper(method), path, timestamp, hex.EncodeToString(bodyHash[:])}, "\n")
+	mac := hmac.New(hashFunc, []byte(a.Secret))
+	mac.Write([]byte(content))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NewAuth 根据配置创建认证方式，config 为 nil 或 Type 为空时返回 nil
+func NewAuth(config *AuthConfig) (AuthInterface, error) {
+	if config == nil || config.Type == "" {
+		return nil, nil
+	}
+	auth, err := MakeAuth(config.Type, string(config.Config))
+	if err != nil {
+		err = errors.WithMessagef(err, "auth %s", config.Type)
+		return nil, err
+	}
+	return auth, nil
+}
+
+// getAuth 获取认证方式，未通过 MakeExecProvider 创建时按配置初始化
+func (p *CURLExecProvider) getAuth() (AuthInterface, error) {
+	p.authOnce.Do(func() {
+		if p.auth == nil {
+			p.auth, p.authErr = NewAuth(p.Config.Auth)
+		}
+	})
+	return p.auth, p.authErr
+}
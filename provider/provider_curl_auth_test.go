@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCURLExecProviderOAuth2(t *testing.T) {
+	var lock sync.Mutex
+	grants := make([]string, 0)
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "app" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+		lock.Lock()
+		grants = append(grants, r.PostForm.Get("grant_type"))
+		n := len(grants)
+		lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token%d","token_type":"bearer","refresh_token":"refresh%d","expires_in":3600}`, n, n)
+	}))
+	defer tokenServer.Close()
+	getGrants := func() string {
+		lock.Lock()
+		defer lock.Unlock()
+		return strings.Join(grants, ",")
+	}
+	revoked := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		lock.Lock()
+		isRevoked := authorization == revoked
+		lock.Unlock()
+		if authorization == "" || isRevoked {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, authorization)
+	}))
+	defer server.Close()
+
+	configJson := fmt.Sprintf(`{"auth":{"type":"oauth2","config":{"tokenURL":"%s","clientID":"app","clientSecret":"secret","scopes":["read"]}}}`, tokenServer.URL)
+	execProvider, err := MakeExecProvider(PROVIDER_CURL, configJson)
+	if err != nil {
+		panic(err)
+	}
+	p := execProvider.(*CURLExecProvider)
+	host := strings.TrimPrefix(server.URL, "http://")
+	raw := fmt.Sprintf("GET %s/user HTTP/1.1\nHost: %s\n", server.URL, host)
+	for i := 0; i < 2; i++ {
+		out, err := p.Exec("user", raw)
+		if err != nil {
+			panic(err)
+		}
+		if !strings.Contains(out, `"body":"Bearer token1"`) {
+			t.Errorf("cached token got %s", out)
+		}
+	}
+	if got := getGrants(); got != "client_credentials" {
+		t.Errorf("token requests got %s, want one client_credentials", got)
+	}
+
+	auth := p.auth.(*OAuth2Auth)
+	auth.token.expiry = time.Now().Add(-time.Second) // 过期后使用 refresh_token 刷新
+	if out, err := p.Exec("user", raw); err != nil || !strings.Contains(out, `"body":"Bearer token2"`) {
+		t.Errorf("refresh token got %s, err %v", out, err)
+	}
+	lock.Lock()
+	revoked = "Bearer token2" // 401 时清除缓存并重新获取
+	lock.Unlock()
+	if out, err := p.Exec("user", raw); err != nil || !strings.Contains(out, `"body":"Bearer token3"`) {
+		t.Errorf("invalidate token got %s, err %v", out, err)
+	}
+	if got := getGrants(); got != "client_credentials,refresh_token,client_credentials" {
+		t.Errorf("token requests got %s", got)
+	}
+
+	if _, err = MakeExecProvider(PROVIDER_CURL, `{"auth":{"type":"oauth2","config":{"clientID":"app"}}}`); err == nil {
+		t.Error("expected tokenURL required error")
+	}
+	if _, err = MakeExecProvider(PROVIDER_CURL, `{"auth":{"type":"unknown"}}`); err == nil {
+		t.Error("expected unknown auth type error")
+	}
+}
+
+func TestCURLExecProviderAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if r.URL.Path == "/sign" {
+			body, _ := io.ReadAll(r.Body)
+			signAuth := &HMACAuth{Secret: "secret"}
+			signature := signAuth.Sign(sha512.New, r.Method, r.URL.RequestURI(), r.Header.Get("X-Sign-Time"), body)
+			if authorization != "HMAC-SHA512 k1:"+signature {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+		fmt.Fprint(w, authorization)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	cases := []struct {
+		auth string
+		want string
+	}{
+		{`{"type":"bearer","config":{"token":"abc"}}`, "Bearer abc"},
+		{`{"type":"basic","config":{"username":"user","password":"pass"}}`, "Basic dXNlcjpwYXNz"},
+	}
+	for _, c := range cases {
+		execProvider, err := MakeExecProvider(PROVIDER_CURL, fmt.Sprintf(`{"auth":%s}`, c.auth))
+		if err != nil {
+			panic(err)
+		}
+		out, err := execProvider.Exec("auth", fmt.Sprintf("GET %s/auth HTTP/1.1\nHost: %s\n", server.URL, host))
+		if err != nil {
+			panic(err)
+		}
+		if !strings.Contains(out, fmt.Sprintf(`"body":"%s"`, c.want)) {
+			t.Errorf("%s got %s", c.auth, out)
+		}
+	}
+
+	p := &CURLExecProvider{Config: CURLExecProviderConfig{Auth: &AuthConfig{
+		Type:   AUTH_HMAC,
+		Config: []byte(`{"keyID":"k1","secret":"secret","algorithm":"hmac-sha512","timestampHeader":"X-Sign-Time"}`),
+	}}}
+	out, err := p.Exec("sign", fmt.Sprintf("POST %s/sign?a=1 HTTP/1.1\nHost: %s\nContent-Type: %s\n\nname=a", server.URL, host, CONTENT_TYPE_FORM))
+	if err != nil {
+		panic(err)
+	}
+	if !strings.Contains(out, `"body":"HMAC-SHA512 k1:`) {
+		t.Errorf("hmac got %s", out)
+	}
+	if _, err = MakeAuth(AUTH_HMAC, `{"secret":"secret","algorithm":"md5"}`); err == nil {
+		t.Error("expected unsupported algorithm error")
+	}
+}
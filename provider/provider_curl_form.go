@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	CONTENT_TYPE_FORM      = "application/x-www-form-urlencoded"
+	CONTENT_TYPE_MULTIPART = "multipart/form-data"
+	HTTP_HEADER_FORM_DATA  = "x-http-form-data" // 请求体为 formData 生成的字段 json，urlencoded 请求需要设置后才编码，不发送到服务端
+)
+
+// FormField 表单字段，File 不为空时为文件字段(仅 multipart)，Filename 默认为文件名，ContentType 默认按扩展名判断
+type FormField struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	File        string `json:"file,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// EncodeForm 按字段顺序生成 application/x-www-form-urlencoded 内容
+func EncodeForm(fields []FormField) (string, error) {
+	pairs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field.File != "" {
+			err := errors.Errorf("form field %s: file only supported by %s", field.Name, CONTENT_TYPE_MULTIPART)
+			return "", err
+		}
+		pairs = append(pairs, url.QueryEscape(field.Name)+"="+url.QueryEscape(field.Value))
+	}
+	return strings.Join(pairs, "&"), nil
+}
+
+// EncodeMultipart 按字段顺序生成 multipart/form-data 内容，返回内容及包含 boundary 的 Content-Type
+func EncodeMultipart(fields []FormField) ([]byte, string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, field := range fields {
+		if field.File == "" {
+			if err := writer.WriteField(field.Name, field.Value); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+		err := writeMultipartFile(writer, field)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
+
+func writeMultipartFile(writer *multipart.Writer, field FormField) error {
+	file, err := os.Open(field.File)
+	if err != nil {
+		err = errors.WithMessagef(err, "form field %s", field.Name)
+		return err
+	}
+	defer file.Close()
+	filename := field.Filename
+	if filename == "" {
+		filename = filepath.Base(field.File)
+	}
+	contentType := field.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": field.Name, "filename": filename}))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file)
+	return err
+}
+
+// buildFormBody Content-Type 为不含 boundary 的 multipart/form-data，或为 application/x-www-form-urlencoded 且 formData(请求头 x-http-form-data) 为 true 时，
+// 请求体为 []FormField json(模板函数 formData 生成)，返回按表单编码后的请求数据，否则返回原请求数据
+func buildFormBody(reqData *RequestData, formData bool) (*RequestData, error) {
+	mediaType, params, err := mime.ParseMediaType(reqData.Header.Get("Content-Type"))
+	if err != nil {
+		return reqData, nil
+	}
+	isMultipart := mediaType == CONTENT_TYPE_MULTIPART && params["boundary"] == ""
+	if !isMultipart && (mediaType != CONTENT_TYPE_FORM || !formData) {
+		return reqData, nil // 未标记的 urlencoded 请求体原样发送
+	}
+	fields := make([]FormField, 0)
+	if err = json.Unmarshal([]byte(strings.TrimSpace(reqData.Body)), &fields); err != nil {
+		err = errors.WithMessage(err, "form body want formData json")
+		return nil, err
+	}
+	sendData := *reqData
+	sendData.Header = reqData.Header.Clone()
+	if isMultipart {
+		b, contentType, err := EncodeMultipart(fields)
+		if err != nil {
+			return nil, err
+		}
+		sendData.Body = string(b)
+		sendData.Header.Set("Content-Type", contentType)
+		return &sendData, nil
+	}
+	sendData.Body, err = EncodeForm(fields)
+	if err != nil {
+		return nil, err
+	}
+	return &sendData, nil
+}
@@ -0,0 +1,202 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	HTTP_HEADER_RETRY        = "x-http-retry"        // 单个请求的重试次数，设置后非幂等方法同样重试，不发送到服务端
+	HTTP_HEADER_RETRY_STATUS = "x-http-retry-status" // 单个请求需要重试的状态码，格式同 SuccessStatus，不发送到服务端
+
+	DEFAULT_RETRY_STATUS      = "429,502-504"
+	DEFAULT_RETRY_BACKOFF     = 100  // 毫秒
+	DEFAULT_RETRY_MAX_BACKOFF = 5000 // 毫秒
+	DEFAULT_BREAKER_COOLDOWN  = 30   // 秒
+)
+
+// idempotentMethods 默认只重试幂等方法
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// retryPolicy 单个请求的重试策略
+type retryPolicy struct {
+	Retry       int
+	Status      string
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	allowMethod bool
+}
+
+// newRetryPolicy 按配置及请求头生成重试策略，请求头中的 x-http-retry 优先
+func newRetryPolicy(config CURLExecProviderConfig, method string, header http.Header) (*retryPolicy, error) {
+	policy := &retryPolicy{
+		Retry:       config.Retry,
+		Status:      config.RetryStatus,
+		Backoff:     time.Duration(config.RetryBackoff) * time.Millisecond,
+		MaxBackoff:  time.Duration(config.RetryMaxBackoff) * time.Millisecond,
+		allowMethod: idempotentMethods[method],
+	}
+	if retryStr := header.Get(HTTP_HEADER_RETRY); retryStr != "" {
+		retry, err := strconv.Atoi(retryStr)
+		if err != nil || retry < 0 {
+			err = errors.Errorf("invalid header %s: %s", HTTP_HEADER_RETRY, retryStr)
+			return nil, err
+		}
+		policy.Retry = retry
+		policy.allowMethod = true // 调用方明确要求重试
+	}
+	if status := header.Get(HTTP_HEADER_RETRY_STATUS); status != "" {
+		policy.Status = status
+	}
+	if policy.Status == "" {
+		policy.Status = DEFAULT_RETRY_STATUS
+	}
+	if _, err := MatchHTTPStatus(policy.Status, http.StatusOK); err != nil {
+		return nil, err
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = DEFAULT_RETRY_BACKOFF * time.Millisecond
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DEFAULT_RETRY_MAX_BACKOFF * time.Millisecond
+	}
+	return policy, nil
+}
+
+// retryable 第 attempt(从 0 开始) 次请求后是否需要重试，ctx 结束时不重试
+func (policy *retryPolicy) retryable(ctx context.Context, attempt int, rsp *http.Response, err error) bool {
+	if attempt >= policy.Retry || !policy.allowMethod || ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	ok, _ := MatchHTTPStatus(policy.Status, rsp.StatusCode)
+	return ok
+}
+
+// wait 指数退避加随机抖动，等待时间在 [d/2, d] 之间，d=Backoff*2^attempt 且不超过 MaxBackoff；响应包含 Retry-After(秒) 时优先使用
+func (policy *retryPolicy) wait(ctx context.Context, attempt int, rsp *http.Response) error {
+	d := policy.MaxBackoff
+	if attempt < 30 && policy.Backoff<<uint(attempt) < policy.MaxBackoff {
+		d = policy.Backoff << uint(attempt)
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	if rsp != nil {
+		if seconds, err := strconv.Atoi(rsp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			d = time.Duration(seconds) * time.Second
+			if d > policy.MaxBackoff {
+				d = policy.MaxBackoff
+			}
+		}
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CircuitOpenError 熔断器打开，请求未发送
+type CircuitOpenError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for host %s until %s", e.Host, e.Until.Format(time.RFC3339))
+}
+
+// circuitBreaker 单个 host 的熔断器，连续失败 threshold 次后打开，cooldown 后允许一个试探请求，成功则关闭，失败则重新打开
+type circuitBreaker struct {
+	lock      sync.Mutex
+	host      string
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.failures < b.threshold {
+		return nil
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return &CircuitOpenError{Host: b.host, Until: b.openUntil}
+	}
+	b.probing = true // 半开状态，只放行一个请求
+	return nil
+}
+
+// record 传输错误及 5xx 视为失败
+func (b *circuitBreaker) record(rsp *http.Response, err error) {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.probing = false
+	if err == nil && rsp.StatusCode < http.StatusInternalServerError {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// release 请求未计入结果(未发送或调用方取消)，结束半开状态的试探，允许下一个请求试探
+func (b *circuitBreaker) release() {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.probing = false
+}
+
+// getBreaker 获取 host 对应的熔断器，未配置 BreakerThreshold 时返回 nil
+func (p *CURLExecProvider) getBreaker(host string) *circuitBreaker {
+	if p.Config.BreakerThreshold <= 0 {
+		return nil
+	}
+	p.breakerLock.Lock()
+	defer p.breakerLock.Unlock()
+	if p.breakers == nil {
+		p.breakers = make(map[string]*circuitBreaker)
+	}
+	breaker, ok := p.breakers[host]
+	if !ok {
+		cooldown := p.Config.BreakerCooldown
+		if cooldown <= 0 {
+			cooldown = DEFAULT_BREAKER_COOLDOWN
+		}
+		breaker = &circuitBreaker{host: host, threshold: p.Config.BreakerThreshold, cooldown: time.Duration(cooldown) * time.Second}
+		p.breakers[host] = breaker
+	}
+	return breaker
+}
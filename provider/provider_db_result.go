@@ -0,0 +1,210 @@
+package provider
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	RESULT_MODE_STRING = ""      // 默认: 值均转换为字符串，单值直接返回，多行返回 json 数组
+	RESULT_MODE_TYPED  = "typed" // 按列类型返回 SQLResult json
+)
+
+// 列类型，决定 typed 模式下值的 json 类型
+const (
+	COLUMN_KIND_NUMBER = "number"
+	COLUMN_KIND_BOOL   = "bool"
+	COLUMN_KIND_BINARY = "binary"
+)
+
+// SQLColumn 结果列，Type 为驱动返回的数据库类型名称
+type SQLColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// SQLResultSet 一个查询结果集
+type SQLResultSet struct {
+	Columns []SQLColumn              `json:"columns"`
+	Rows    []map[string]interface{} `json:"rows"`
+}
+
+// SQLResult typed 模式的返回结构，数字为 json 数字，NULL 为 null，二进制为 base64 字符串，时间按方言 TimeLayout 格式化；
+// Columns、Rows 为第一个结果集，多结果集时 ResultSets 包含全部结果集，多条写语句时 Statements 为每条语句的结果；
+// RowsAffected、LastInsertId 为写语句的结果，查询时为 0(行数使用 len(Rows))
+type SQLResult struct {
+	Columns      []SQLColumn              `json:"columns"`
+	Rows         []map[string]interface{} `json:"rows"`
+	RowsAffected int64                    `json:"rowsAffected"`
+	LastInsertId int64                    `json:"lastInsertId"`
+	ResultSets   []SQLResultSet           `json:"resultSets,omitempty"`
+	Statements   []SQLWriteResult         `json:"statements,omitempty"`
+}
+
+// SQLWriteResult 一条写语句的执行结果
+type SQLWriteResult struct {
+	LastInsertId int64 `json:"lastInsertId"`
+	RowsAffected int64 `json:"rowsAffected"`
+}
+
+// scalar 默认模式下单条写语句的结果，lastInsertId 大于 0 时返回 lastInsertId，否则返回 rowsAffected
+func (r SQLWriteResult) scalar() string {
+	if r.LastInsertId > 0 {
+		return strconv.FormatInt(r.LastInsertId, 10)
+	}
+	return strconv.FormatInt(r.RowsAffected, 10)
+}
+
+func validResultMode(mode string) error {
+	if mode != RESULT_MODE_STRING && mode != RESULT_MODE_TYPED {
+		err := errors.Errorf("sql result mode want %s or empty, got %s", RESULT_MODE_TYPED, mode)
+		return err
+	}
+	return nil
+}
+
+// typedWriteResult 写语句的 SQLResult，多条语句时 RowsAffected 为合计，LastInsertId 为最后一个非 0 值
+func typedWriteResult(results []SQLWriteResult) (string, error) {
+	result := SQLResult{
+		Columns: make([]SQLColumn, 0),
+		Rows:    make([]map[string]interface{}, 0),
+	}
+	for _, writeResult := range results {
+		result.RowsAffected += writeResult.RowsAffected
+		if writeResult.LastInsertId != 0 {
+			result.LastInsertId = writeResult.LastInsertId
+		}
+	}
+	if len(results) > 1 {
+		result.Statements = results
+	}
+	return marshalJSON(result)
+}
+
+func typedQuery(ctx context.Context, db sqlExecutor, dialect SQLDialect, sqls string, args ...interface{}) (string, error) {
+	result := SQLResult{}
+	rows, err := db.QueryContext(ctx, sqls, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	resultSets := make([]SQLResultSet, 0)
+	for {
+		resultSet, err := scanResultSet(rows, dialect)
+		if err != nil {
+			return "", err
+		}
+		resultSets = append(resultSets, *resultSet)
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+	result.Columns = resultSets[0].Columns
+	result.Rows = resultSets[0].Rows
+	if len(resultSets) > 1 {
+		result.ResultSets = resultSets
+	}
+	return marshalJSON(result)
+}
+
+func scanResultSet(rows *sql.Rows, dialect SQLDialect) (*SQLResultSet, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	resultSet := &SQLResultSet{
+		Columns: make([]SQLColumn, 0, len(columnTypes)),
+		Rows:    make([]map[string]interface{}, 0),
+	}
+	kinds := make([]string, 0, len(columnTypes))
+	for _, columnType := range columnTypes {
+		resultSet.Columns = append(resultSet.Columns, SQLColumn{Name: columnType.Name(), Type: columnType.DatabaseTypeName()})
+		kinds = append(kinds, columnKind(columnType.DatabaseTypeName()))
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(columnTypes))
+		for i := range values {
+			values[i] = new(interface{})
+		}
+		err = rows.Scan(values...)
+		if err != nil {
+			return nil, err
+		}
+		record := make(map[string]interface{}, len(columnTypes))
+		for i, column := range resultSet.Columns {
+			record[column.Name] = dialect.typedValue(kinds[i], *(values[i].(*interface{})))
+		}
+		resultSet.Rows = append(resultSet.Rows, record)
+	}
+	return resultSet, nil
+}
+
+// columnKind 根据数据库类型名称判断列类型，如 INT、UNSIGNED BIGINT、DECIMAL(10,2)、BYTEA
+func columnKind(databaseTypeName string) string {
+	name := strings.ToUpper(strings.TrimSpace(databaseTypeName))
+	if i := strings.Index(name, "("); i >= 0 {
+		name = strings.TrimSpace(name[:i])
+	}
+	name = strings.TrimSpace(strings.TrimPrefix(name, "UNSIGNED"))
+	name = strings.TrimSpace(strings.TrimSuffix(name, "UNSIGNED"))
+	switch name {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "INT2", "INT4", "INT8", "YEAR",
+		"DECIMAL", "NUMERIC", "FLOAT", "FLOAT4", "FLOAT8", "DOUBLE", "DOUBLE PRECISION", "REAL":
+		return COLUMN_KIND_NUMBER
+	case "BOOL", "BOOLEAN":
+		return COLUMN_KIND_BOOL
+	case "BINARY", "VARBINARY", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BYTEA":
+		return COLUMN_KIND_BINARY
+	}
+	return ""
+}
+
+// typedValue 扫描值转换为 json 值，mysql 文本协议返回的 []byte 按列类型转换
+func (d SQLDialect) typedValue(kind string, v interface{}) interface{} {
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		return value.Format(d.TimeLayout)
+	case []byte:
+		if kind == COLUMN_KIND_BINARY || !utf8.Valid(value) {
+			return base64.StdEncoding.EncodeToString(value)
+		}
+		return typedString(kind, string(value))
+	case string:
+		return typedString(kind, value)
+	case int64, float64, bool:
+		if kind == COLUMN_KIND_BOOL {
+			if i, ok := value.(int64); ok {
+				return i != 0
+			}
+		}
+		return value
+	}
+	return v
+}
+
+func typedString(kind string, s string) interface{} {
+	switch kind {
+	case COLUMN_KIND_NUMBER:
+		if _, err := strconv.ParseFloat(s, 64); err == nil && json.Valid([]byte(s)) {
+			return json.Number(s) // 保留 DECIMAL 精度
+		}
+	case COLUMN_KIND_BOOL:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return s
+}
@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestDBExecProviderTypedResult(t *testing.T) {
+	if _, err := MakeExecProvider(PROVIDER_SQL, `{"resultMode":"any"}`); err == nil {
+		t.Error("expected unknown result mode error")
+	}
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	_, err = db.Exec("create table `user` (`id` integer primary key autoincrement, `name` text, `price` decimal(10,2), `avatar` blob, `deleted_at` datetime)")
+	if err != nil {
+		panic(err)
+	}
+	execProvider := &DBExecProvider{Config: DBExecProviderConfig{Dialect: DIALECT_SQLITE, ResultMode: RESULT_MODE_TYPED}}
+	execProvider.SetDb(db)
+	ctx := context.Background()
+
+	out, err := execProvider.ExecSQL(ctx, "insertUser", "insert into `user` (`name`,`price`,`avatar`) values (?,?,?)", "张三", 12.5, []byte{0xff, 0x00})
+	if err != nil {
+		panic(err)
+	}
+	var result SQLResult
+	err = json.Unmarshal([]byte(out), &result)
+	if err != nil {
+		panic(err)
+	}
+	if result.LastInsertId != 1 || result.RowsAffected != 1 || len(result.Rows) != 0 {
+		t.Errorf("insert got %s", out)
+	}
+
+	out, err = execProvider.ExecSQL(ctx, "getUser", "select `id`,`name`,`price`,`avatar`,`deleted_at` from `user` where `id`=?", 1)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(out)
+	var got map[string]interface{}
+	err = json.Unmarshal([]byte(out), &got)
+	if err != nil {
+		panic(err)
+	}
+	want := map[string]interface{}{
+		"columns": []interface{}{
+			map[string]interface{}{"name": "id", "type": "INTEGER"},
+			map[string]interface{}{"name": "name", "type": "TEXT"},
+			map[string]interface{}{"name": "price", "type": "DECIMAL(10,2)"},
+			map[string]interface{}{"name": "avatar", "type": "BLOB"},
+			map[string]interface{}{"name": "deleted_at", "type": "DATETIME"},
+		},
+		"rows": []interface{}{
+			map[string]interface{}{"id": float64(1), "name": "张三", "price": 12.5, "avatar": "/wA=", "deleted_at": nil},
+		},
+		"rowsAffected": float64(0),
+		"lastInsertId": float64(0),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("select got %s", out)
+	}
+
+	out, err = execProvider.ExecSQL(ctx, "getNone", "select `id` from `user` where `id`=?", 2)
+	if err != nil {
+		panic(err)
+	}
+	if want := `{"columns":[{"name":"id","type":"INTEGER"}],"rows":[],"rowsAffected":0,"lastInsertId":0}`; out != want {
+		t.Errorf("empty select got %s, want %s", out, want)
+	}
+}
+
+func TestColumnKind(t *testing.T) {
+	cases := map[string]string{
+		"INT":              COLUMN_KIND_NUMBER,
+		"UNSIGNED BIGINT":  COLUMN_KIND_NUMBER,
+		"decimal(10,2)":    COLUMN_KIND_NUMBER,
+		"DOUBLE PRECISION": COLUMN_KIND_NUMBER,
+		"BOOLEAN":          COLUMN_KIND_BOOL,
+		"BYTEA":            COLUMN_KIND_BINARY,
+		"VARCHAR(255)":     "",
+		"POINT":            "",
+		"INTERVAL":         "",
+	}
+	for name, want := range cases {
+		if got := columnKind(name); got != want {
+			t.Errorf("%s got %s, want %s", name, got, want)
+		}
+	}
+	mysql, _ := GetDialect(DIALECT_MYSQL)
+	if got := mysql.typedValue(COLUMN_KIND_NUMBER, []byte("12345678901234567890.12")); got != json.Number("12345678901234567890.12") {
+		t.Errorf("decimal got %#v", got)
+	}
+	if got := mysql.typedValue(COLUMN_KIND_BOOL, int64(1)); got != true {
+		t.Errorf("bool got %#v", got)
+	}
+}
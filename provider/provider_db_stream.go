@@ -0,0 +1,188 @@
+package provider
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/templatemap/util"
+)
+
+const (
+	STREAM_FORMAT_NDJSON = "ndjson"
+	STREAM_FORMAT_CSV    = "csv"
+)
+
+// SQLStreamExecproviderInterface 流式查询，逐行读取结果，不在内存中保存整个结果集
+type SQLStreamExecproviderInterface interface {
+	SQLExecproviderInterface
+	QuerySQL(ctx context.Context, identifier string, statement string, args ...interface{}) (*SQLRows, error)
+}
+
+// SQLRows 流式查询结果(仅第一个结果集)，使用完毕后必须调用 Close
+type SQLRows struct {
+	rows    *sql.Rows
+	dialect SQLDialect
+	typed   bool
+	columns []SQLColumn
+	kinds   []string
+	values  []interface{}
+	err     error
+}
+
+func newSQLRows(rows *sql.Rows, dialect SQLDialect, typed bool) (*SQLRows, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	r := &SQLRows{
+		rows:    rows,
+		dialect: dialect,
+		typed:   typed,
+		columns: make([]SQLColumn, 0, len(columnTypes)),
+		kinds:   make([]string, 0, len(columnTypes)),
+		values:  make([]interface{}, len(columnTypes)),
+	}
+	for _, columnType := range columnTypes {
+		r.columns = append(r.columns, SQLColumn{Name: columnType.Name(), Type: columnType.DatabaseTypeName()})
+		r.kinds = append(r.kinds, columnKind(columnType.DatabaseTypeName()))
+	}
+	return r, nil
+}
+
+// Columns 结果列
+func (r *SQLRows) Columns() []SQLColumn {
+	return r.columns
+}
+
+// Next 读取下一行，返回 false 时通过 Err 判断是否出错
+func (r *SQLRows) Next() bool {
+	if !r.rows.Next() {
+		return false
+	}
+	pointers := make([]interface{}, len(r.values))
+	for i := range r.values {
+		pointers[i] = &r.values[i]
+	}
+	if err := r.rows.Scan(pointers...); err != nil {
+		r.err = err
+		r.rows.Close()
+		return false
+	}
+	return true
+}
+
+// Record 当前行，ResultMode 为 typed 时值同 SQLResult，否则为字符串(NULL 为空字符串)
+func (r *SQLRows) Record() map[string]interface{} {
+	record := make(map[string]interface{}, len(r.columns))
+	for i, column := range r.columns {
+		if r.typed {
+			record[column.Name] = r.dialect.typedValue(r.kinds[i], r.values[i])
+		} else {
+			record[column.Name] = r.dialect.FormatValue(r.values[i])
+		}
+	}
+	return record
+}
+
+// Strings 当前行按列顺序转换为字符串，二进制列为 base64
+func (r *SQLRows) Strings() []string {
+	out := make([]string, len(r.values))
+	for i, v := range r.values {
+		if b, ok := v.([]byte); ok && r.kinds[i] == COLUMN_KIND_BINARY {
+			out[i] = base64.StdEncoding.EncodeToString(b)
+			continue
+		}
+		out[i] = r.dialect.FormatValue(v)
+	}
+	return out
+}
+
+// Err 读取过程中的错误
+func (r *SQLRows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rows.Err()
+}
+
+// Close 释放连接，可重复调用
+func (r *SQLRows) Close() error {
+	return r.rows.Close()
+}
+
+// QuerySQL 流式执行查询语句，ctx 中存在事务时使用事务执行
+func (p *DBExecProvider) QuerySQL(ctx context.Context, identifier string, statement string, args ...interface{}) (*SQLRows, error) {
+	dialect, err := p.dialect()
+	if err != nil {
+		return nil, err
+	}
+	sqls := util.StandardizeSpaces(dialect.StripComments(util.TrimSpaces(statement)))
+	statements := dialect.SplitStatements(sqls)
+	if len(statements) != 1 || !statements[0].Query {
+		err := errors.Errorf("stream sql %s required one query statement, got: %s", identifier, sqls)
+		return nil, err
+	}
+	db, err := getExecutor(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, dialect.Prepare(statements[0].SQL, len(args) > 0), args...)
+	if err != nil {
+		return nil, err
+	}
+	sqlRows, err := newSQLRows(rows, dialect, p.Config.ResultMode == RESULT_MODE_TYPED)
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return sqlRows, nil
+}
+
+// WriteRows 将 rows 按 format(ndjson、csv) 写入 w 并关闭 rows，返回写入的行数(csv 不含表头)
+func WriteRows(w io.Writer, rows *SQLRows, format string) (count int, err error) {
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	switch format {
+	case STREAM_FORMAT_NDJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		for rows.Next() {
+			if err = encoder.Encode(rows.Record()); err != nil {
+				return count, err
+			}
+			count++
+		}
+	case STREAM_FORMAT_CSV:
+		writer := csv.NewWriter(w)
+		header := make([]string, 0, len(rows.Columns()))
+		for _, column := range rows.Columns() {
+			header = append(header, column.Name)
+		}
+		if err = writer.Write(header); err != nil {
+			return count, err
+		}
+		for rows.Next() {
+			if err = writer.Write(rows.Strings()); err != nil {
+				return count, err
+			}
+			count++
+		}
+		writer.Flush()
+		if err = writer.Error(); err != nil {
+			return count, err
+		}
+	default:
+		err = errors.Errorf("stream format want %s or %s, got %s", STREAM_FORMAT_NDJSON, STREAM_FORMAT_CSV, format)
+		return count, err
+	}
+	return count, rows.Err()
+}
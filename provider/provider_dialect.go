@@ -0,0 +1,224 @@
+package provider
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	DIALECT_MYSQL    = "mysql"
+	DIALECT_POSTGRES = "postgres"
+	DIALECT_SQLITE   = "sqlite"
+)
+
+// SQLDialect 数据库方言，模板统一使用 mysql 风格书写(` 引用标识符，命名参数转换为 ? 占位符)，执行前按方言转换
+type SQLDialect struct {
+	Name            string
+	DriverName      string // database/sql 驱动名称，驱动需由调用方导入(mysql 除外)
+	BindType        int    // 占位符类型: sqlx.QUESTION(?)、sqlx.DOLLAR($1)
+	IdentifierQuote string // 标识符引号，模板中的 ` 转换为该字符
+	BackslashEscape bool   // 字符串中 \ 是否为转义符，为 false 时 ' 转义为 ''
+	TimeLayout      string // 时间类型结果的格式
+}
+
+var (
+	dialectLock sync.RWMutex
+	dialectMap  = map[string]SQLDialect{
+		DIALECT_MYSQL: {
+			Name:            DIALECT_MYSQL,
+			DriverName:      "mysql",
+			BindType:        sqlx.QUESTION,
+			IdentifierQuote: "`",
+			BackslashEscape: true,
+			TimeLayout:      "2006-01-02 15:04:05",
+		},
+		DIALECT_POSTGRES: {
+			Name:            DIALECT_POSTGRES,
+			DriverName:      "postgres",
+			BindType:        sqlx.DOLLAR,
+			IdentifierQuote: `"`,
+			TimeLayout:      time.RFC3339Nano,
+		},
+		DIALECT_SQLITE: {
+			Name:            DIALECT_SQLITE,
+			DriverName:      "sqlite",
+			BindType:        sqlx.QUESTION,
+			IdentifierQuote: `"`,
+			TimeLayout:      "2006-01-02 15:04:05",
+		},
+	}
+)
+
+// RegisterDialect 注册方言，同名覆盖
+func RegisterDialect(dialect SQLDialect) error {
+	if dialect.Name == "" {
+		err := errors.Errorf("dialect name required")
+		return err
+	}
+	dialectLock.Lock()
+	defer dialectLock.Unlock()
+	dialectMap[dialect.Name] = dialect
+	return nil
+}
+
+// GetDialect 获取已注册的方言
+func GetDialect(name string) (SQLDialect, bool) {
+	dialectLock.RLock()
+	defer dialectLock.RUnlock()
+	dialect, ok := dialectMap[name]
+	return dialect, ok
+}
+
+// SQLDialectInterface 执行器使用的数据库方言
+type SQLDialectInterface interface {
+	GetDialect() SQLDialect
+}
+
+// DialectOf 获取执行器的方言，未实现 SQLDialectInterface 时为 mysql
+func DialectOf(p ExecproviderInterface) SQLDialect {
+	if dialectProvider, ok := p.(SQLDialectInterface); ok {
+		return dialectProvider.GetDialect()
+	}
+	dialect, _ := GetDialect(DIALECT_MYSQL)
+	return dialect
+}
+
+// Prepare 将模板生成的 mysql 风格语句转换为方言语句: 替换标识符引号，hasArgs 为 true 时转换占位符，字符串中的内容不变
+func (d SQLDialect) Prepare(statement string, hasArgs bool) string {
+	rebind := hasArgs && d.BindType != sqlx.QUESTION
+	requote := d.IdentifierQuote != "" && d.IdentifierQuote != "`"
+	if !rebind && !requote {
+		return statement
+	}
+	var b strings.Builder
+	index := 0
+	inString := false
+	for i := 0; i < len(statement); i++ {
+		c := statement[i]
+		if inString {
+			b.WriteByte(c)
+			if c == '\\' && d.BackslashEscape && i+1 < len(statement) {
+				b.WriteByte(statement[i+1])
+				i++
+			} else if c == '\'' {
+				if i+1 < len(statement) && statement[i+1] == '\'' {
+					b.WriteByte('\'')
+					i++
+				} else {
+					inString = false
+				}
+			}
+			continue
+		}
+		switch {
+		case c == '\'':
+			inString = true
+			b.WriteByte(c)
+		case c == '`' && requote:
+			b.WriteString(d.IdentifierQuote)
+		case c == '?' && rebind:
+			index++
+			b.WriteString("$" + strconv.Itoa(index))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// ExplainSQL 将参数拼接到 ? 占位符语句中，结果仅用于日志、预览及录制回放的键
+func (d SQLDialect) ExplainSQL(statement string, args ...interface{}) string {
+	var b strings.Builder
+	index := 0
+	inString := false
+	for i := 0; i < len(statement); i++ {
+		c := statement[i]
+		if inString {
+			b.WriteByte(c)
+			if c == '\\' && d.BackslashEscape && i+1 < len(statement) {
+				b.WriteByte(statement[i+1])
+				i++
+			} else if c == '\'' {
+				inString = false // '' 视为两个相邻的字符串，结果相同
+			}
+			continue
+		}
+		if c == '\'' {
+			inString = true
+		}
+		if c == '?' && index < len(args) {
+			b.WriteString(d.quoteValue(args[index]))
+			index++
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func (d SQLDialect) quoteString(s string) string {
+	if d.BackslashEscape {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+		return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (d SQLDialect) quoteValue(v interface{}) string {
+	if valuer, ok := v.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return d.quoteString(fmt.Sprintf("%v", v))
+		}
+		v = value
+	}
+	switch value := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return d.quoteString(value)
+	case []byte:
+		return d.quoteString(string(value))
+	case time.Time:
+		return d.quoteString(value.Format(d.TimeLayout))
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprintf("%v", value)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "NULL"
+		}
+		return d.quoteValue(rv.Elem().Interface())
+	}
+	return d.quoteString(fmt.Sprintf("%v", v))
+}
+
+// FormatValue 查询结果转换为字符串，NULL 为空字符串
+func (d SQLDialect) FormatValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case time.Time:
+		return value.Format(d.TimeLayout)
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSQLDialectPrepare(t *testing.T) {
+	statement := "select * from `user` where `name`=? and `note`='it''s `a`?' and `id` in (?,?)"
+	cases := map[string]string{
+		DIALECT_MYSQL:    statement,
+		DIALECT_SQLITE:   `select * from "user" where "name"=? and "note"='it''s ` + "`a`" + `?' and "id" in (?,?)`,
+		DIALECT_POSTGRES: `select * from "user" where "name"=$1 and "note"='it''s ` + "`a`" + `?' and "id" in ($2,$3)`,
+	}
+	for name, want := range cases {
+		dialect, ok := GetDialect(name)
+		if !ok {
+			t.Fatalf("dialect %s not registered", name)
+		}
+		if got := dialect.Prepare(statement, true); got != want {
+			t.Errorf("%s got %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestSQLDialectExplainSQL(t *testing.T) {
+	statement := "insert into `user` (`name`,`age`,`deleted_at`,`created_at`) values (?,?,?,?)"
+	createdAt := time.Date(2022, 6, 1, 8, 0, 0, 0, time.UTC)
+	args := []interface{}{`a'b\c`, 18, nil, createdAt}
+	mysql, _ := GetDialect(DIALECT_MYSQL)
+	want := "insert into `user` (`name`,`age`,`deleted_at`,`created_at`) values ('a\\'b\\\\c',18,NULL,'2022-06-01 08:00:00')"
+	if got := mysql.ExplainSQL(statement, args...); got != want {
+		t.Errorf("mysql got %s, want %s", got, want)
+	}
+	postgres, _ := GetDialect(DIALECT_POSTGRES)
+	want = "insert into `user` (`name`,`age`,`deleted_at`,`created_at`) values ('a''b\\c',18,NULL,'2022-06-01T08:00:00Z')"
+	if got := postgres.ExplainSQL(statement, args...); got != want {
+		t.Errorf("postgres got %s, want %s", got, want)
+	}
+	if got := mysql.ExplainSQL("select '?' from `t` where `a`=?", 1); got != "select '?' from `t` where `a`=1" {
+		t.Errorf("placeholder in string replaced: %s", got)
+	}
+}
+
+func TestDBExecProviderDialect(t *testing.T) {
+	if _, err := MakeExecProvider(PROVIDER_SQL, `{"dialect":"oracle"}`); err == nil {
+		t.Error("expected unknown dialect error")
+	}
+	execProvider, err := MakeExecProvider(PROVIDER_SQL, `{"dialect":"postgres"}`)
+	if err != nil {
+		panic(err)
+	}
+	if name := DialectOf(execProvider).Name; name != DIALECT_POSTGRES {
+		t.Errorf("got dialect %s", name)
+	}
+	if name := DialectOf(&echoExecProvider{}).Name; name != DIALECT_MYSQL {
+		t.Errorf("default dialect got %s", name)
+	}
+
+	p := &DBExecProvider{Config: DBExecProviderConfig{Dialect: "oracle", DSN: "oracle://"}} // 未通过 MakeExecProvider 校验
+	if name := p.GetDialect().Name; name != DIALECT_MYSQL {
+		t.Errorf("unknown dialect render got %s", name)
+	}
+	if _, err = p.ExecSQL(context.Background(), "getUser", "select 1"); err == nil {
+		t.Error("ExecSQL expected unknown dialect error")
+	}
+	if _, err = p.QuerySQL(context.Background(), "getUser", "select 1"); err == nil {
+		t.Error("QuerySQL expected unknown dialect error")
+	}
+}
@@ -0,0 +1,302 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	shellwords "github.com/mattn/go-shellwords"
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/suifengpiao14/templatemap/util"
+)
+
+const AMQP_METHOD_PUBLISH = "PUBLISH"
+
+func init() {
+	MustRegister(PROVIDER_RABBITMQ, func(configJson string) (ExecproviderInterface, error) {
+		var config AMQPExecProviderConfig
+		err := DecodeConfig(configJson, &config)
+		if err != nil {
+			return nil, err
+		}
+		return &AMQPExecProvider{Config: config}, nil
+	})
+}
+
+// AMQPMessage 模板渲染后的待发布消息
+type AMQPMessage struct {
+	Exchange   string                 `json:"exchange"`
+	RoutingKey string                 `json:"routingKey"`
+	Headers    map[string]interface{} `json:"headers"`
+	Publishing amqp.Publishing        `json:"-"`
+}
+
+// PublishConfirm 消息发布确认结果
+type PublishConfirm struct {
+	Exchange    string `json:"exchange"`
+	RoutingKey  string `json:"routingKey"`
+	MessageId   string `json:"messageId"`
+	DeliveryTag uint64 `json:"deliveryTag"`
+	Ack         bool   `json:"ack"`
+}
+
+// AMQPPublisherInterface 消息发布器，测试时使用 MemoryAMQPBroker 替代真实服务
+type AMQPPublisherInterface interface {
+	Publish(ctx context.Context, message *AMQPMessage) (*PublishConfirm, error)
+}
+
+type AMQPExecProviderConfig struct {
+	URL      string `json:"url"`
+	LogLevel string `json:"logLevel"`
+	Timeout  int    `json:"timeout"`
+}
+
+type AMQPExecProvider struct {
+	Config        AMQPExecProviderConfig
+	Publisher     AMQPPublisherInterface // 为空时根据 Config.URL 连接 AMQP 服务
+	publisherOnce sync.Once
+}
+
+func (p *AMQPExecProvider) Exec(identifier string, s string) (string, error) {
+	return amqpProvider(context.Background(), p, s)
+}
+
+func (p *AMQPExecProvider) ExecContext(ctx context.Context, identifier string, s string) (string, error) {
+	return amqpProvider(ctx, p, s)
+}
+
+func (p *AMQPExecProvider) GetSource() (source interface{}) {
+	return p.GetPublisher()
+}
+
+func (p *AMQPExecProvider) GetPublisher() AMQPPublisherInterface {
+	p.publisherOnce.Do(func() {
+		if p.Publisher == nil {
+			p.Publisher = &amqpPublisher{url: p.Config.URL}
+		}
+	})
+	return p.Publisher
+}
+
+func amqpProvider(ctx context.Context, p *AMQPExecProvider, raw string) (string, error) {
+	message, err := ReadAMQPMessage(raw)
+	if err != nil {
+		return "", err
+	}
+	timeout := 30
+	if p.Config.Timeout > 0 {
+		timeout = p.Config.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	confirm, err := p.GetPublisher().Publish(ctx, message)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(confirm)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ReadAMQPMessage 解析模板输出，格式同 http 请求:
+// 首行 PUBLISH <exchange> <routingKey>，之后为头部，空行后为消息体；头部每行前后空白会被去除(兼容模板缩进)，消息体原样发送
+// Content-Type、Content-Encoding、Message-Id、Correlation-Id、Reply-To、Expiration、Type、App-Id、Delivery-Mode、Priority(不区分大小写)写入消息属性，
+// 其余写入 headers，AMQP headers 区分大小写，键保持原样
+func ReadAMQPMessage(raw string) (message *AMQPMessage, err error) {
+	raw = strings.TrimLeft(raw, " \t\r\n")
+	if raw == "" {
+		err = errors.Errorf("amqp raw not allow empty")
+		return nil, err
+	}
+	headLines := make([]string, 0)
+	body := ""
+	rest := raw
+	for rest != "" {
+		line := rest
+		rest = ""
+		if i := strings.Index(line, EOF); i > -1 {
+			line, rest = line[:i], line[i+len(EOF):]
+		}
+		line = util.TrimSpaces(line)
+		if line == "" {
+			body = rest // 只去除头部与消息体之间的空行
+			break
+		}
+		headLines = append(headLines, line)
+	}
+	line := headLines[0]
+	args, err := shellwords.Parse(line)
+	if err != nil {
+		err = errors.WithMessagef(err, "parse amqp line: %s", line)
+		return nil, err
+	}
+	if len(args) != 3 || strings.ToUpper(args[0]) != AMQP_METHOD_PUBLISH {
+		err = errors.Errorf("amqp line want: PUBLISH <exchange> <routingKey>, got: %s", line)
+		return nil, err
+	}
+	message = &AMQPMessage{
+		Exchange:   args[1],
+		RoutingKey: args[2],
+		Headers:    make(map[string]interface{}),
+		Publishing: amqp.Publishing{
+			Timestamp: time.Now(),
+			Body:      []byte(body),
+		},
+	}
+	publishing := &message.Publishing
+	for _, headLine := range headLines[1:] {
+		i := strings.Index(headLine, ":")
+		if i < 1 {
+			err = errors.Errorf("amqp header want: <key>: <value>, got: %s", headLine)
+			return nil, err
+		}
+		key, value := util.TrimSpaces(headLine[:i]), util.TrimSpaces(headLine[i+1:])
+		switch textproto.CanonicalMIMEHeaderKey(key) {
+		case "Content-Type":
+			publishing.ContentType = value
+		case "Content-Encoding":
+			publishing.ContentEncoding = value
+		case "Message-Id":
+			publishing.MessageId = value
+		case "Correlation-Id":
+			publishing.CorrelationId = value
+		case "Reply-To":
+			publishing.ReplyTo = value
+		case "Expiration":
+			publishing.Expiration = value
+		case "Type":
+			publishing.Type = value
+		case "App-Id":
+			publishing.AppId = value
+		case "Delivery-Mode":
+			if strings.EqualFold(value, "persistent") || value == "2" {
+				publishing.DeliveryMode = amqp.Persistent
+			}
+		case "Priority":
+			priority, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, err
+			}
+			publishing.Priority = uint8(priority)
+		default:
+			message.Headers[key] = value
+		}
+	}
+	publishing.Headers = amqp.Table(message.Headers)
+	return message, nil
+}
+
+// amqpPublisher 使用 publisher confirm 模式发布消息，连接断开后下次发布时重连
+type amqpPublisher struct {
+	url     string
+	lock    sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+}
+
+func (p *amqpPublisher) getChannel() (*amqp.Channel, error) {
+	if p.conn == nil || p.conn.IsClosed() {
+		conn, err := amqp.Dial(p.url)
+		if err != nil {
+			err = errors.WithMessage(err, "amqp dial")
+			return nil, err
+		}
+		p.conn = conn
+		p.channel = nil
+	}
+	if p.channel == nil {
+		channel, err := p.conn.Channel()
+		if err != nil {
+			return nil, err
+		}
+		err = channel.Confirm(false)
+		if err != nil {
+			return nil, err
+		}
+		p.channel = channel
+	}
+	return p.channel, nil
+}
+
+func (p *amqpPublisher) Publish(ctx context.Context, message *AMQPMessage) (*PublishConfirm, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	channel, err := p.getChannel()
+	if err != nil {
+		return nil, err
+	}
+	deferredConfirm, err := channel.PublishWithDeferredConfirmWithContext(ctx, message.Exchange, message.RoutingKey, false, false, message.Publishing)
+	if err != nil {
+		p.channel = nil // 发布失败时通道可能已被服务端关闭，下次重新打开
+		return nil, err
+	}
+	confirm := &PublishConfirm{
+		Exchange:    message.Exchange,
+		RoutingKey:  message.RoutingKey,
+		MessageId:   message.Publishing.MessageId,
+		DeliveryTag: deferredConfirm.DeliveryTag,
+	}
+	ackChan := make(chan bool, 1)
+	go func() {
+		ackChan <- deferredConfirm.Wait()
+	}()
+	select {
+	case confirm.Ack = <-ackChan:
+	case <-ctx.Done():
+		err = errors.WithMessagef(ctx.Err(), "wait amqp confirm deliveryTag:%d", confirm.DeliveryTag)
+		return nil, err
+	}
+	if !confirm.Ack {
+		err = errors.Errorf("amqp message nack exchange:%s routingKey:%s", message.Exchange, message.RoutingKey)
+		return confirm, err
+	}
+	return confirm, nil
+}
+
+// MemoryAMQPBroker 内存消息代理，记录发布的消息，用于测试
+type MemoryAMQPBroker struct {
+	lock     sync.Mutex
+	messages []AMQPMessage
+	Nack     bool // 为 true 时拒绝所有消息
+}
+
+func NewMemoryAMQPBroker() *MemoryAMQPBroker {
+	return &MemoryAMQPBroker{}
+}
+
+func (b *MemoryAMQPBroker) Publish(ctx context.Context, message *AMQPMessage) (*PublishConfirm, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	confirm := &PublishConfirm{
+		Exchange:   message.Exchange,
+		RoutingKey: message.RoutingKey,
+		MessageId:  message.Publishing.MessageId,
+		Ack:        !b.Nack,
+	}
+	if b.Nack {
+		err := errors.Errorf("amqp message nack exchange:%s routingKey:%s", message.Exchange, message.RoutingKey)
+		return confirm, err
+	}
+	b.messages = append(b.messages, *message)
+	confirm.DeliveryTag = uint64(len(b.messages))
+	return confirm, nil
+}
+
+// Messages 已发布的消息(按发布顺序)
+func (b *MemoryAMQPBroker) Messages() []AMQPMessage {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	out := make([]AMQPMessage, len(b.messages))
+	copy(out, b.messages)
+	return out
+}
@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestAMQPProvider(t *testing.T) {
+	broker := NewMemoryAMQPBroker()
+	execProvider := &AMQPExecProvider{Publisher: broker}
+	input := `
+	PUBLISH data.change user.updated
+	content-type: application/json
+	Message-Id: 1001
+	Delivery-Mode: persistent
+	x-source: templatemap
+	X-Trace-ID: abc
+
+{"userId":1}`
+	out, err := execProvider.Exec("publishUserUpdated", input)
+	if err != nil {
+		panic(err)
+	}
+	want := `{"exchange":"data.change","routingKey":"user.updated","messageId":"1001","deliveryTag":1,"ack":true}`
+	if out != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+	messages := broker.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages", len(messages))
+	}
+	publishing := messages[0].Publishing
+	if string(publishing.Body) != `{"userId":1}` || publishing.ContentType != "application/json" || publishing.DeliveryMode != 2 {
+		t.Errorf("got publishing %#v", publishing)
+	}
+	if publishing.Headers["x-source"] != "templatemap" || publishing.Headers["X-Trace-ID"] != "abc" || len(publishing.Headers) != 2 {
+		t.Errorf("headers must keep original keys, got %#v", publishing.Headers)
+	}
+	message, err := ReadAMQPMessage("PUBLISH data.change user.updated\r\nx-source: a\r\n\r\n  line1\r\n\r\n")
+	if err != nil {
+		panic(err)
+	}
+	if body := string(message.Publishing.Body); body != "  line1\r\n\r\n" {
+		t.Errorf("body must not be trimmed, got %q", body)
+	}
+
+	broker.Nack = true
+	if _, err = execProvider.Exec("publishUserUpdated", input); err == nil {
+		t.Error("expected nack error")
+	}
+	if _, err = ReadAMQPMessage("GET /user HTTP/1.1"); err == nil {
+		t.Error("expected invalid amqp line error")
+	}
+}
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"os/exec"
@@ -12,11 +13,21 @@ import (
 	"github.com/suifengpiao14/templatemap/util"
 )
 
+func init() {
+	MustRegister(PROVIDER_BIN, func(configJson string) (ExecproviderInterface, error) {
+		return &BinExecProvider{}, nil
+	})
+}
+
 type BinExecProvider struct {
 }
 
 func (p *BinExecProvider) Exec(identifier string, s string) (string, error) {
-	return binProvider(p, s)
+	return binProvider(context.Background(), p, s)
+}
+
+func (p *BinExecProvider) ExecContext(ctx context.Context, identifier string, s string) (string, error) {
+	return binProvider(ctx, p, s)
 }
 
 func (p *BinExecProvider) GetSource() (source interface{}) {
@@ -24,7 +35,7 @@ func (p *BinExecProvider) GetSource() (source interface{}) {
 	panic(err)
 }
 
-func binProvider(p *BinExecProvider, input string) (string, error) {
+func binProvider(ctx context.Context, p *BinExecProvider, input string) (string, error) {
 	// Start subprocess
 	input = util.StandardizeSpaces(input)
 	input = strings.ReplaceAll(input, WINDOW_EOF, EOF)
@@ -46,7 +57,7 @@ func binProvider(p *BinExecProvider, input string) (string, error) {
 		return "", err
 	}
 	var cmd *exec.Cmd
-	cmd = exec.Command(args[0], args[1:]...)
+	cmd = exec.CommandContext(ctx, args[0], args[1:]...)
 
 	// Get handles to subprocess stdin, stdout and stderr
 	stdinPipe, err := cmd.StdinPipe()
@@ -127,7 +138,7 @@ func binProvider(p *BinExecProvider, input string) (string, error) {
 	if cmdErr != nil {
 		// We don't return here because we also want to try to write stdout if
 		// there was some output
-		err = errors.WithMessagef(err, "error running subprocess: %v", err)
+		err = errors.WithMessagef(cmdErr, "error running subprocess: %v", cmdErr)
 	}
 
 	return string(stdout), err
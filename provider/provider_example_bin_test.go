@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strings"
@@ -23,7 +24,7 @@ func TestSplitN(t *testing.T) {
 	}
 	body := strings.NewReader(script[1])
 	b, _ := io.ReadAll(body)
-	fmt.Printf(string(b))
+	fmt.Print(string(b))
 }
 
 func TestBinProvider(t *testing.T) {
@@ -32,9 +33,9 @@ func TestBinProvider(t *testing.T) {
 	ping -n 3 
 	baidu.com
 	`
-	out, err := binProvider(binExecProvider, input)
+	out, err := binProvider(context.Background(), binExecProvider, input)
 	if err != nil {
 		panic(err)
 	}
-	fmt.Printf(out)
+	fmt.Print(out)
 }
@@ -4,12 +4,15 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,7 +28,41 @@ const (
 	HTTP_HEAD_BODY_DELIM = EOF + EOF
 )
 
-var CURL_TIMEOUT = 30 * time.Millisecond
+// CURL_TIMEOUT 未配置 Timeout 时单次请求的超时时间
+var CURL_TIMEOUT = 30 * time.Second
+
+const (
+	HTTP_HEADER_TIMEOUT        = "x-http-timeout"
+	HTTP_HEADER_SUCCESS_STATUS = "x-http-success-status" // 单个请求的成功状态码，格式同 CURLExecProviderConfig.SuccessStatus，不发送到服务端
+	HTTP_SUCCESS_STATUS_ANY    = "*"
+)
+
+func init() {
+	MustRegister(PROVIDER_CURL, func(configJson string) (ExecproviderInterface, error) {
+		var config CURLExecProviderConfig
+		err := DecodeConfig(configJson, &config)
+		if err != nil {
+			return nil, err
+		}
+		_, err = MatchHTTPStatus(config.SuccessStatus, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		_, err = MatchHTTPStatus(config.RetryStatus, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		client, err := NewHTTPClient(config)
+		if err != nil {
+			return nil, err
+		}
+		auth, err := NewAuth(config.Auth)
+		if err != nil {
+			return nil, err
+		}
+		return &CURLExecProvider{Config: config, client: client, auth: auth}, nil
+	})
+}
 
 type RequestData struct {
 	URL     string         `json:"url"`
@@ -42,26 +79,105 @@ type ResponseData struct {
 	RequestData *RequestData   `json:"requestData"`
 }
 
+// CURLExecProviderConfig SuccessStatus 为视为成功的状态码，逗号分隔，支持 200、2xx、200-299 及 *(全部)，默认 200；
+// Retry 为幂等方法在传输错误或 RetryStatus(默认 429,502-504) 时的重试次数，RetryBackoff、RetryMaxBackoff 为退避时间(毫秒)；
+// BreakerThreshold 大于 0 时按 host 熔断，连续失败(传输错误或 5xx)达到该次数后 BreakerCooldown(秒，默认 30) 内直接返回 *CircuitOpenError；
+// 超时时间单位为秒: Timeout 为单次请求的总超时(默认 CURL_TIMEOUT)，DialTimeout 为连接超时(默认同 Timeout，均未配置时 10)，
+// TLSHandshakeTimeout 默认 10，ResponseHeaderTimeout 默认不限制；CAFile 为 PEM 格式的 CA 证书(追加到系统证书)，CertFile、KeyFile 为客户端证书；
+// HTTP2 为 true 时 https 请求优先使用 HTTP/2；Auth 为认证方式(bearer、basic、oauth2、hmac 或 RegisterAuth 注册的名称)，每次发送前设置认证信息
 type CURLExecProviderConfig struct {
-	Proxy               string `json:"proxy"`
-	LogLevel            string `json:"logLevel"`
-	Timeout             int    `json:"timeout"`
-	KeepAlive           int    `json:"keepAlive"`
-	MaxIdleConns        int    `json:"maxIdleConns"`
-	MaxIdleConnsPerHost int    `json:"maxIdleConnsPerHost"`
-	IdleConnTimeout     int    `json:"idleConnTimeout"`
+	Proxy                 string      `json:"proxy"`
+	LogLevel              string      `json:"logLevel"`
+	Timeout               int         `json:"timeout"`
+	KeepAlive             int         `json:"keepAlive"`
+	MaxIdleConns          int         `json:"maxIdleConns"`
+	MaxIdleConnsPerHost   int         `json:"maxIdleConnsPerHost"`
+	IdleConnTimeout       int         `json:"idleConnTimeout"`
+	SuccessStatus         string      `json:"successStatus"`
+	Retry                 int         `json:"retry"`
+	RetryStatus           string      `json:"retryStatus"`
+	RetryBackoff          int         `json:"retryBackoff"`
+	RetryMaxBackoff       int         `json:"retryMaxBackoff"`
+	BreakerThreshold      int         `json:"breakerThreshold"`
+	BreakerCooldown       int         `json:"breakerCooldown"`
+	DialTimeout           int         `json:"dialTimeout"`
+	TLSHandshakeTimeout   int         `json:"tlsHandshakeTimeout"`
+	ResponseHeaderTimeout int         `json:"responseHeaderTimeout"`
+	CAFile                string      `json:"caFile"`
+	CertFile              string      `json:"certFile"`
+	KeyFile               string      `json:"keyFile"`
+	InsecureSkipVerify    bool        `json:"insecureSkipVerify"` // 仅用于测试环境
+	HTTP2                 bool        `json:"http2"`
+	Auth                  *AuthConfig `json:"auth"`
+}
+
+// HTTPStatusError 响应状态码不在成功状态码中，Response 为完整响应(同执行器输出)
+type HTTPStatusError struct {
+	StatusCode int
+	Response   *ResponseData
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("response httpstatus:%d, body: %s", e.StatusCode, e.Response.Body)
+}
+
+// MatchHTTPStatus 判断状态码是否符合 successStatus(格式同 CURLExecProviderConfig.SuccessStatus)，为空时只有 200 成功
+func MatchHTTPStatus(successStatus string, statusCode int) (bool, error) {
+	successStatus = strings.TrimSpace(successStatus)
+	if successStatus == "" {
+		return statusCode == http.StatusOK, nil
+	}
+	for _, item := range strings.Split(successStatus, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		min, max := 0, 0
+		var err error
+		switch {
+		case item == HTTP_SUCCESS_STATUS_ANY:
+			return true, nil
+		case len(item) == 3 && strings.HasSuffix(item, "xx"):
+			min, err = strconv.Atoi(item[:1])
+			min, max = min*100, min*100+99
+		case strings.Contains(item, "-"):
+			pair := strings.SplitN(item, "-", 2)
+			min, err = strconv.Atoi(strings.TrimSpace(pair[0]))
+			if err == nil {
+				max, err = strconv.Atoi(strings.TrimSpace(pair[1]))
+			}
+		default:
+			min, err = strconv.Atoi(item)
+			max = min
+		}
+		if err != nil || min > max {
+			err = errors.Errorf("invalid http success status %s", successStatus)
+			return false, err
+		}
+		if statusCode >= min && statusCode <= max {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 type CURLExecProvider struct {
-	Config     CURLExecProviderConfig
-	client     *http.Client
-	clinetOnce sync.Once
+	Config      CURLExecProviderConfig
+	client      *http.Client
+	clinetOnce  sync.Once
+	breakerLock sync.Mutex
+	breakers    map[string]*circuitBreaker
+	clientErr   error
+	auth        AuthInterface
+	authErr     error
+	authOnce    sync.Once
 }
 
 func (p *CURLExecProvider) Exec(identifier string, s string) (string, error) {
 	return CURlProvider(p, s)
 }
 
+func (p *CURLExecProvider) ExecContext(ctx context.Context, identifier string, s string) (string, error) {
+	return CURlProviderContext(ctx, p, s)
+}
+
 func (p *CURLExecProvider) GetSource() (source interface{}) {
 	return p.client
 }
@@ -74,112 +190,210 @@ func (p *CURLExecProvider) Commit(tx interface{}) (err error) {
 	return nil
 }
 
-// GetDb is a signal DB
+// GetClient http 客户端，配置错误时 panic，发送请求时使用 getClient 返回错误
 func (p *CURLExecProvider) GetClient() *http.Client {
-	if p.client == nil {
-		p.clinetOnce.Do(func() {
-			p.client = InitHTTPClient(p)
-
-		})
+	client, err := p.getClient()
+	if err != nil {
+		panic(err)
 	}
-	return p.client
+	return client
+}
+
+// getClient 获取 http 客户端，未通过 MakeExecProvider 创建时按配置初始化，初始化错误缓存后每次返回
+func (p *CURLExecProvider) getClient() (*http.Client, error) {
+	p.clinetOnce.Do(func() {
+		if p.client == nil {
+			p.client, p.clientErr = NewHTTPClient(p.Config)
+		}
+	})
+	return p.client, p.clientErr
 }
 
 func InitHTTPClient(p *CURLExecProvider) *http.Client {
+	httpClient, err := NewHTTPClient(p.Config)
+	if err != nil {
+		panic(err)
+	}
+	return httpClient
+}
 
+// NewHTTPClient 按配置创建 http 客户端，代理地址、证书文件错误时返回错误
+func NewHTTPClient(config CURLExecProviderConfig) (*http.Client, error) {
 	maxIdleConns := 200
 	maxIdleConnsPerHost := 20
 	idleConnTimeout := 90
-	if p.Config.MaxIdleConns > 0 {
-		maxIdleConns = p.Config.MaxIdleConns
+	if config.MaxIdleConns > 0 {
+		maxIdleConns = config.MaxIdleConns
 	}
-	if p.Config.MaxIdleConnsPerHost > 0 {
-		maxIdleConnsPerHost = p.Config.MaxIdleConnsPerHost
+	if config.MaxIdleConnsPerHost > 0 {
+		maxIdleConnsPerHost = config.MaxIdleConnsPerHost
 	}
-	if p.Config.IdleConnTimeout > 0 {
-		idleConnTimeout = p.Config.IdleConnTimeout
+	if config.IdleConnTimeout > 0 {
+		idleConnTimeout = config.IdleConnTimeout
 	}
-	timeout := 10
-	if p.Config.Timeout > 0 {
-		timeout = 10
+	dialTimeout := 10
+	if config.DialTimeout > 0 {
+		dialTimeout = config.DialTimeout
+	} else if config.Timeout > 0 {
+		dialTimeout = config.Timeout
+	}
+	tlsHandshakeTimeout := 10
+	if config.TLSHandshakeTimeout > 0 {
+		tlsHandshakeTimeout = config.TLSHandshakeTimeout
 	}
 	keepAlive := 300
-	if p.Config.KeepAlive > 0 {
-		keepAlive = p.Config.KeepAlive
+	if config.KeepAlive > 0 {
+		keepAlive = config.KeepAlive
+	}
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
 	}
 	transport := &http.Transport{
 		DialContext: (&net.Dialer{
-			Timeout:   time.Duration(timeout) * time.Second,   // 连接超时时间
-			KeepAlive: time.Duration(keepAlive) * time.Second, // 连接保持超时时间
+			Timeout:   time.Duration(dialTimeout) * time.Second, // 连接超时时间
+			KeepAlive: time.Duration(keepAlive) * time.Second,   // 连接保持超时时间
 		}).DialContext,
-		MaxIdleConns:        maxIdleConns,                                 // 最大连接数,默认0无穷大
-		MaxIdleConnsPerHost: maxIdleConnsPerHost,                          // 对每个host的最大连接数量(MaxIdleConnsPerHost<=MaxIdleConns)
-		IdleConnTimeout:     time.Duration(idleConnTimeout) * time.Second, // 多长时间未使用自动关闭连
+		MaxIdleConns:          maxIdleConns,                                              // 最大连接数,默认0无穷大
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,                                       // 对每个host的最大连接数量(MaxIdleConnsPerHost<=MaxIdleConns)
+		IdleConnTimeout:       time.Duration(idleConnTimeout) * time.Second,              // 多长时间未使用自动关闭连
+		TLSHandshakeTimeout:   time.Duration(tlsHandshakeTimeout) * time.Second,          // TLS 握手超时时间
+		ResponseHeaderTimeout: time.Duration(config.ResponseHeaderTimeout) * time.Second, // 发送请求后等待响应头的时间，0 不限制
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     config.HTTP2,
+	}
+	if !config.HTTP2 {
+		transport.TLSNextProto = make(map[string]func(authority string, c *tls.Conn) http.RoundTripper) // 非 nil 空 map 禁用 HTTP/2
 	}
-	if p.Config.Proxy != "" {
-		proxy, err := url.Parse(p.Config.Proxy)
+	if config.Proxy != "" {
+		proxy, err := url.Parse(config.Proxy)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		transport.Proxy = http.ProxyURL(proxy)
 	}
 	httpClient := &http.Client{
 		Transport: transport,
 	}
-	return httpClient
+	return httpClient, nil
+}
+
+func newTLSConfig(config CURLExecProviderConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			err = errors.Errorf("no certificate found in ca file %s", config.CAFile)
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			err = errors.WithMessage(err, "load client certificate")
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
 }
 
 func CURlProvider(p *CURLExecProvider, httpRaw string) (string, error) {
+	return CURlProviderContext(context.Background(), p, httpRaw)
+}
+
+// CURlProviderContext 发送请求，超时时间在 ctx 基础上计算，ctx 取消时请求同时取消
+func CURlProviderContext(ctx context.Context, p *CURLExecProvider, httpRaw string) (string, error) {
 	reqReader, err := ReadRequest(httpRaw)
 	if err != nil {
 		return "", err
 	}
+	successStatus := p.Config.SuccessStatus
+	if status := reqReader.Header.Get(HTTP_HEADER_SUCCESS_STATUS); status != "" {
+		successStatus = status // 优先使用定制化的成功状态码
+	}
+	if _, err = MatchHTTPStatus(successStatus, http.StatusOK); err != nil {
+		return "", err // 格式错误时不发送请求
+	}
+	policy, err := newRetryPolicy(p.Config, reqReader.Method, reqReader.Header)
+	if err != nil {
+		return "", err
+	}
+	formData := reqReader.Header.Get(HTTP_HEADER_FORM_DATA) != ""
+	for _, key := range []string{HTTP_HEADER_SUCCESS_STATUS, HTTP_HEADER_RETRY, HTTP_HEADER_RETRY_STATUS, HTTP_HEADER_FORM_DATA} {
+		reqReader.Header.Del(key)
+	}
 	reqData, err := Request2RequestData(reqReader)
 	if err != nil {
 		return "", err
 	}
-	timeout := 30
+	sendData, err := buildFormBody(reqData, formData) // 响应中的 RequestData 保留模板生成的表单 json
+	if err != nil {
+		return "", err
+	}
+	timeoutDuration := CURL_TIMEOUT
 	if p.Config.Timeout > 0 {
-		timeout = p.Config.Timeout
+		timeoutDuration = time.Duration(p.Config.Timeout) * time.Second
 	}
-	timeoutStr := reqReader.Header.Get("x-http-timeout")
+	timeoutStr := reqReader.Header.Get(HTTP_HEADER_TIMEOUT)
 	if timeoutStr != "" {
 		timeoutInt, _ := strconv.Atoi(timeoutStr)
 		if timeoutInt > 0 {
-			timeout = timeoutInt // 优先使用定制化的超时时间
+			timeoutDuration = time.Duration(timeoutInt) * time.Second // 优先使用定制化的超时时间
 		}
 	}
-	timeoutDuration := time.Duration(timeout) * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutDuration)
-	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, reqData.Method, reqData.URL, bytes.NewReader([]byte(reqData.Body)))
-	if err != nil {
-		return "", err
-	}
-
-	for k, vArr := range reqData.Header {
-		for _, v := range vArr {
-			req.Header.Add(k, v)
-		}
+	host := reqReader.URL.Host
+	if host == "" {
+		host = reqReader.Host
 	}
-
-	rsp, err := p.GetClient().Do(req)
+	breaker := p.getBreaker(host)
+	client, err := p.getClient()
 	if err != nil {
 		return "", err
 	}
-
-	defer rsp.Body.Close()
-	b, err := io.ReadAll(rsp.Body)
+	auth, err := p.getAuth()
 	if err != nil {
 		return "", err
 	}
-	if err != nil {
-		msg := fmt.Sprintf("response httpstatus:%d, body: %s", rsp.StatusCode, string(b))
-		err = errors.WithMessage(err, msg)
-		return "", err
+	var rsp *http.Response
+	var b []byte
+	reauth := false
+	for attempt := 0; ; attempt++ {
+		err = breaker.allow()
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		var sent bool
+		rsp, b, sent, err = p.do(ctx, client, sendData, timeoutDuration, auth)
+		if sent && ctx.Err() == nil {
+			breaker.record(rsp, err)
+		} else {
+			breaker.release() // 请求未发送(如获取认证信息失败)或调用方取消，与 host 状态无关
+		}
+		if invalidator, ok := auth.(AuthInvalidator); ok && err == nil && rsp.StatusCode == http.StatusUnauthorized && !reauth {
+			invalidator.Invalidate() // 凭证失效时重新获取并立即重发一次，不计入重试次数
+			reauth = true
+			attempt--
+			continue
+		}
+		if !policy.retryable(ctx, attempt, rsp, err) {
+			break
+		}
+		if waitErr := policy.wait(ctx, attempt, rsp); waitErr != nil {
+			break
+		}
 	}
-	if rsp.StatusCode != http.StatusOK {
-		err := errors.Errorf("response httpstatus:%d, body: %s", rsp.StatusCode, string(b))
+	if err != nil {
 		return "", err
 	}
 
@@ -195,10 +409,45 @@ func CURlProvider(p *CURLExecProvider, httpRaw string) (string, error) {
 		return "", err
 	}
 	out := string(jsonByte)
-
+	if ok, _ := MatchHTTPStatus(successStatus, rsp.StatusCode); !ok {
+		err = errors.WithStack(&HTTPStatusError{StatusCode: rsp.StatusCode, Response: &rspData})
+		return out, err // 非成功状态同样返回响应，调用方可按 httpStatus 处理
+	}
 	return out, nil
 }
 
+// do 发送一次请求并读取响应体，超时时间为单次请求的时间(包括获取认证信息)，sent 表示请求是否已发送
+func (p *CURLExecProvider) do(ctx context.Context, client *http.Client, reqData *RequestData, timeout time.Duration, auth AuthInterface) (rsp *http.Response, b []byte, sent bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, reqData.Method, reqData.URL, bytes.NewReader([]byte(reqData.Body)))
+	if err != nil {
+		return nil, nil, false, err
+	}
+	for k, vArr := range reqData.Header {
+		for _, v := range vArr {
+			req.Header.Add(k, v)
+		}
+	}
+	if auth != nil {
+		err = auth.Apply(ctx, client, req, []byte(reqData.Body))
+		if err != nil {
+			err = errors.WithMessage(err, "apply auth")
+			return nil, nil, false, err
+		}
+	}
+	rsp, err = client.Do(req)
+	if err != nil {
+		return nil, nil, true, err
+	}
+	defer rsp.Body.Close()
+	b, err = io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, nil, true, err
+	}
+	return rsp, b, true, nil
+}
+
 func ReadRequest(httpRaw string) (req *http.Request, err error) {
 	httpRaw = util.TrimSpaces(httpRaw) // （删除前后空格，对于没有body 内容的请求，后面再加上必要的换行）
 	if httpRaw == "" {
@@ -0,0 +1,443 @@
+package provider
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func newCURLTestServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HTTP_HEADER_SUCCESS_STATUS) != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "control header sent")
+			return
+		}
+		switch r.URL.Path {
+		case "/created":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "1"})
+			w.Header().Set("Location", "/user/1")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id":1}`)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"not found"}`)
+		default:
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMatchHTTPStatus(t *testing.T) {
+	cases := []struct {
+		successStatus string
+		statusCode    int
+		want          bool
+	}{
+		{"", 200, true},
+		{"", 201, false},
+		{"2xx", 204, true},
+		{"200,201", 201, true},
+		{"200-299, 404", 404, true},
+		{"200-299", 302, false},
+		{"*", 500, true},
+	}
+	for _, c := range cases {
+		got, err := MatchHTTPStatus(c.successStatus, c.statusCode)
+		if err != nil {
+			panic(err)
+		}
+		if got != c.want {
+			t.Errorf("%s %d got %v", c.successStatus, c.statusCode, got)
+		}
+	}
+	for _, successStatus := range []string{"abc", "299-200", "2x"} {
+		if _, err := MatchHTTPStatus(successStatus, 200); err == nil {
+			t.Errorf("%s expected invalid error", successStatus)
+		}
+	}
+	if _, err := MakeExecProvider(PROVIDER_CURL, `{"successStatus":"ok"}`); err == nil {
+		t.Error("expected invalid success status config error")
+	}
+}
+
+func TestCURLExecProviderSuccessStatus(t *testing.T) {
+	server := newCURLTestServer(t)
+	host := strings.TrimPrefix(server.URL, "http://")
+	p := &CURLExecProvider{}
+	out, err := p.Exec("create", fmt.Sprintf("POST %s/created HTTP/1.1\nHost: %s\n\n{}", server.URL, host))
+	var statusError *HTTPStatusError
+	if !errors.As(err, &statusError) || statusError.StatusCode != http.StatusCreated {
+		t.Fatalf("default success status expected HTTPStatusError, got %v", err)
+	}
+	var rspData ResponseData
+	err = json.Unmarshal([]byte(out), &rspData)
+	if err != nil {
+		panic(err)
+	}
+	if rspData.HttpStatus != "201" || rspData.Body != `{"id":1}` || rspData.Header.Get("Location") != "/user/1" || len(rspData.Cookies) != 1 {
+		t.Errorf("response got %s", out)
+	}
+	if statusError.Response.Body != rspData.Body {
+		t.Errorf("error response body got %s", statusError.Response.Body)
+	}
+
+	p = &CURLExecProvider{Config: CURLExecProviderConfig{SuccessStatus: "2xx"}}
+	if _, err = p.Exec("create", fmt.Sprintf("POST %s/created HTTP/1.1\nHost: %s\n\n{}", server.URL, host)); err != nil {
+		t.Errorf("2xx got %v", err)
+	}
+	if _, err = p.Exec("missing", fmt.Sprintf("GET %s/missing HTTP/1.1\nHost: %s\n", server.URL, host)); err == nil {
+		t.Error("2xx expected 404 error")
+	}
+	out, err = p.Exec("missing", fmt.Sprintf("GET %s/missing HTTP/1.1\nHost: %s\n%s: 2xx,404\n", server.URL, host, HTTP_HEADER_SUCCESS_STATUS))
+	if err != nil {
+		panic(err)
+	}
+	if !strings.Contains(out, `"httpStatus":"404"`) {
+		t.Errorf("header success status got %s", out)
+	}
+
+	var requests int32
+	countServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer countServer.Close()
+	raw := fmt.Sprintf("POST %s/user HTTP/1.1\nHost: %s\n%s: abc\n\n{}", countServer.URL, strings.TrimPrefix(countServer.URL, "http://"), HTTP_HEADER_SUCCESS_STATUS)
+	if _, err = p.Exec("invalid", raw); err == nil {
+		t.Error("invalid header success status expected error")
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("invalid header success status sent %d requests, want 0", n)
+	}
+}
+
+func TestCURLExecProviderRetry(t *testing.T) {
+	var lock sync.Mutex
+	attempts := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		key := r.Method + r.URL.Path
+		attempts[key]++
+		n := attempts[key]
+		lock.Unlock()
+		if r.Header.Get(HTTP_HEADER_RETRY) != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch {
+		case r.URL.Path == "/down":
+			w.WriteHeader(http.StatusInternalServerError)
+		case n <= 2:
+			w.Header().Set("Retry-After", "60") // 超过 RetryMaxBackoff 时使用 RetryMaxBackoff
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer server.Close()
+	count := func(key string) int {
+		lock.Lock()
+		defer lock.Unlock()
+		return attempts[key]
+	}
+	host := strings.TrimPrefix(server.URL, "http://")
+	p := &CURLExecProvider{Config: CURLExecProviderConfig{Retry: 2, RetryBackoff: 1, RetryMaxBackoff: 5, BreakerThreshold: 3}}
+
+	out, err := p.Exec("flaky", fmt.Sprintf("GET %s/flaky HTTP/1.1\nHost: %s\n", server.URL, host))
+	if err != nil {
+		panic(err)
+	}
+	if !strings.Contains(out, `"body":"ok"`) || count("GET/flaky") != 3 {
+		t.Errorf("GET got %d attempts, out %s", count("GET/flaky"), out)
+	}
+	if _, err = p.Exec("flaky", fmt.Sprintf("POST %s/flaky HTTP/1.1\nHost: %s\n\n{}", server.URL, host)); err == nil || count("POST/flaky") != 1 {
+		t.Errorf("POST must not retry by default, got %d attempts, err %v", count("POST/flaky"), err)
+	}
+	if _, err = p.Exec("flaky", fmt.Sprintf("POST %s/flaky HTTP/1.1\nHost: %s\n%s: 1\n\n{}", server.URL, host, HTTP_HEADER_RETRY)); err != nil || count("POST/flaky") != 3 {
+		t.Errorf("POST with %s got %d attempts, err %v", HTTP_HEADER_RETRY, count("POST/flaky"), err)
+	}
+
+	downRaw := fmt.Sprintf("GET %s/down HTTP/1.1\nHost: %s\n%s: 0\n", server.URL, host, HTTP_HEADER_RETRY)
+	for i := 0; i < 3; i++ {
+		var statusError *HTTPStatusError
+		if _, err = p.Exec("down", downRaw); !errors.As(err, &statusError) {
+			t.Errorf("down expected HTTPStatusError, got %v", err)
+		}
+	}
+	var openError *CircuitOpenError
+	if _, err = p.Exec("down", downRaw); !errors.As(err, &openError) || count("GET/down") != 3 {
+		t.Errorf("expected CircuitOpenError without request, got %d attempts, err %v", count("GET/down"), err)
+	}
+	p.getBreaker(host).openUntil = time.Now() // 冷却结束，允许一个试探请求
+	if _, err = p.Exec("down", downRaw); errors.As(err, &openError) || count("GET/down") != 4 {
+		t.Errorf("half open expected one request, got %d attempts, err %v", count("GET/down"), err)
+	}
+	if _, err = p.Exec("down", downRaw); !errors.As(err, &openError) {
+		t.Errorf("failed probe expected reopen, got %v", err)
+	}
+}
+
+func TestCURLExecProviderBreakerIgnore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	tokenServer := httptest.NewServer(http.NotFoundHandler())
+	tokenServer.Close() // 认证失败，请求未发送
+	host := strings.TrimPrefix(server.URL, "http://")
+	p := &CURLExecProvider{Config: CURLExecProviderConfig{BreakerThreshold: 1}}
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := p.ExecContext(ctx, "slow", fmt.Sprintf("GET %s/slow HTTP/1.1\nHost: %s\n", server.URL, host))
+		cancel()
+		var openError *CircuitOpenError
+		if err == nil || errors.As(err, &openError) {
+			t.Errorf("canceled request expected context error, got %v", err)
+		}
+	}
+	authProvider := &CURLExecProvider{Config: CURLExecProviderConfig{BreakerThreshold: 1, Auth: &AuthConfig{
+		Type:   AUTH_OAUTH2,
+		Config: []byte(fmt.Sprintf(`{"tokenURL":"%s","clientID":"app"}`, tokenServer.URL)),
+	}}}
+	for i := 0; i < 2; i++ {
+		var openError *CircuitOpenError
+		if _, err := authProvider.Exec("auth", fmt.Sprintf("GET %s/ok HTTP/1.1\nHost: %s\n", server.URL, host)); err == nil || errors.As(err, &openError) {
+			t.Errorf("auth failure expected auth error, got %v", err)
+		}
+	}
+	if out, err := p.Exec("ok", fmt.Sprintf("GET %s/ok HTTP/1.1\nHost: %s\n", server.URL, host)); err != nil || !strings.Contains(out, `"body":"ok"`) {
+		t.Errorf("breaker must stay closed, got %s, err %v", out, err)
+	}
+	if failures := p.getBreaker(host).failures + authProvider.getBreaker(host).failures; failures != 0 {
+		t.Errorf("breaker failures got %d, want 0", failures)
+	}
+}
+
+// writeTestPEM 写入 PEM 文件
+func writeTestPEM(t *testing.T, name string, blockType string, der []byte) string {
+	file := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+	if err != nil {
+		panic(err)
+	}
+	return file
+}
+
+// newTestClientCert 生成自签名客户端证书，返回证书、证书文件及私钥文件
+func newTestClientCert(t *testing.T) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "templatemap-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+	return cert, writeTestPEM(t, "client.crt", "CERTIFICATE", der), writeTestPEM(t, "client.key", "EC PRIVATE KEY", keyDer)
+}
+
+func TestCURLExecProviderTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientName := ""
+		if len(r.TLS.PeerCertificates) > 0 {
+			clientName = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		fmt.Fprintf(w, "%s %s", r.Proto, clientName)
+	}))
+	clientCert, certFile, keyFile := newTestClientCert(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	caFile := writeTestPEM(t, "ca.crt", "CERTIFICATE", server.Certificate().Raw)
+	httpRaw := fmt.Sprintf("GET %s/ HTTP/1.1\nHost: %s\n", server.URL, strings.TrimPrefix(server.URL, "https://"))
+
+	cases := []struct {
+		name   string
+		config string
+		body   string
+	}{
+		{"insecure", `{"insecureSkipVerify":true}`, "HTTP/1.1 "},
+		{"ca", fmt.Sprintf(`{"caFile":%q}`, caFile), "HTTP/1.1 "},
+		{"http2", fmt.Sprintf(`{"caFile":%q,"http2":true}`, caFile), "HTTP/2.0 "},
+		{"clientCert", fmt.Sprintf(`{"caFile":%q,"certFile":%q,"keyFile":%q}`, caFile, certFile, keyFile), "HTTP/1.1 templatemap-client"},
+	}
+	for _, c := range cases {
+		p, err := MakeExecProvider(PROVIDER_CURL, c.config)
+		if err != nil {
+			panic(err)
+		}
+		out, err := p.Exec(c.name, httpRaw)
+		if err != nil {
+			t.Errorf("%s got error %v", c.name, err)
+			continue
+		}
+		var rspData ResponseData
+		if err = json.Unmarshal([]byte(out), &rspData); err != nil {
+			panic(err)
+		}
+		if rspData.Body != c.body {
+			t.Errorf("%s got body %q, want %q", c.name, rspData.Body, c.body)
+		}
+	}
+
+	if _, err := (&CURLExecProvider{}).Exec("untrusted", httpRaw); err == nil {
+		t.Error("expected unknown authority error")
+	}
+	for _, config := range []string{`{"caFile":"not-exists.pem"}`, fmt.Sprintf(`{"certFile":%q}`, certFile), `{"proxy":"://"}`} {
+		if _, err := MakeExecProvider(PROVIDER_CURL, config); err == nil {
+			t.Errorf("%s expected config error", config)
+		}
+	}
+	p := &CURLExecProvider{Config: CURLExecProviderConfig{CAFile: "not-exists.pem"}} // 未通过 MakeExecProvider 校验
+	for i := 0; i < 2; i++ {
+		if _, err := p.Exec("badConfig", httpRaw); err == nil {
+			t.Error("struct literal provider expected config error")
+		}
+	}
+}
+
+func TestNewHTTPClientTimeout(t *testing.T) {
+	client, err := NewHTTPClient(CURLExecProviderConfig{Timeout: 3, TLSHandshakeTimeout: 4, ResponseHeaderTimeout: 5})
+	if err != nil {
+		panic(err)
+	}
+	transport := client.Transport.(*http.Transport)
+	if transport.TLSHandshakeTimeout != 4*time.Second || transport.ResponseHeaderTimeout != 5*time.Second {
+		t.Errorf("got tls handshake timeout %s, response header timeout %s", transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+	old := CURL_TIMEOUT
+	CURL_TIMEOUT = 50 * time.Millisecond
+	defer func() { CURL_TIMEOUT = old }()
+	_, err = (&CURLExecProvider{}).Exec("slow", fmt.Sprintf("GET %s/ HTTP/1.1\nHost: %s\n", server.URL, strings.TrimPrefix(server.URL, "http://")))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected CURL_TIMEOUT deadline exceeded, got %v", err)
+	}
+}
+
+func TestCURLExecProviderFormBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseMultipartForm(1 << 20)
+		if err != nil && err != http.ErrNotMultipart {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		out := fmt.Sprintf("name=%s tags=%s", r.PostForm.Get("name"), strings.Join(r.PostForm["tags"], "|"))
+		if r.MultipartForm != nil {
+			for _, file := range r.MultipartForm.File["avatar"] {
+				f, err := file.Open()
+				if err != nil {
+					panic(err)
+				}
+				b, _ := io.ReadAll(f)
+				f.Close()
+				out += fmt.Sprintf(" file=%s(%s):%s", file.Filename, file.Header.Get("Content-Type"), b)
+			}
+		}
+		fmt.Fprint(w, out)
+	}))
+	defer server.Close()
+	file := filepath.Join(t.TempDir(), "avatar.txt")
+	if err := os.WriteFile(file, []byte("hello\r\n"), 0o644); err != nil {
+		panic(err)
+	}
+	host := strings.TrimPrefix(server.URL, "http://")
+	fields := []FormField{{Name: "name", Value: "张 三&"}, {Name: "tags", Value: "a"}, {Name: "tags", Value: "b"}, {Name: "avatar", File: file}}
+	fieldsJson, err := json.Marshal(fields)
+	if err != nil {
+		panic(err)
+	}
+	p := &CURLExecProvider{}
+	out, err := p.Exec("upload", fmt.Sprintf("POST %s/upload HTTP/1.1\nHost: %s\nContent-Type: %s\n\n%s", server.URL, host, CONTENT_TYPE_MULTIPART, fieldsJson))
+	if err != nil {
+		panic(err)
+	}
+	var rspData ResponseData
+	if err = json.Unmarshal([]byte(out), &rspData); err != nil {
+		panic(err)
+	}
+	if want := "name=张 三& tags=a|b file=avatar.txt(text/plain; charset=utf-8):hello\r\n"; rspData.Body != want {
+		t.Errorf("multipart got %q, want %q", rspData.Body, want)
+	}
+	if rspData.RequestData.Body != string(fieldsJson) {
+		t.Errorf("request data body want form json, got %s", rspData.RequestData.Body)
+	}
+
+	formJson, _ := json.Marshal(fields[:3])
+	out, err = p.Exec("form", fmt.Sprintf("POST %s/form HTTP/1.1\nHost: %s\nContent-Type: %s\n%s: 1\n\n%s", server.URL, host, CONTENT_TYPE_FORM, HTTP_HEADER_FORM_DATA, formJson))
+	if err != nil {
+		panic(err)
+	}
+	if err = json.Unmarshal([]byte(out), &rspData); err != nil {
+		panic(err)
+	}
+	if want := "name=张 三& tags=a|b"; rspData.Body != want {
+		t.Errorf("urlencoded got %q, want %q", rspData.Body, want)
+	}
+	if _, err = p.Exec("form", fmt.Sprintf("POST %s/form HTTP/1.1\nHost: %s\nContent-Type: %s\n%s: 1\n\n%s", server.URL, host, CONTENT_TYPE_FORM, HTTP_HEADER_FORM_DATA, fieldsJson)); err == nil {
+		t.Error("expected file not supported by urlencoded error")
+	}
+	out, err = p.Exec("form", fmt.Sprintf("POST %s/form HTTP/1.1\nHost: %s\nContent-Type: %s\n\nname=raw", server.URL, host, CONTENT_TYPE_FORM))
+	if err != nil || !strings.Contains(out, `"body":"name=raw tags="`) {
+		t.Errorf("raw urlencoded body got %s, err %v", out, err)
+	}
+	out, err = p.Exec("form", fmt.Sprintf("POST %s/form HTTP/1.1\nHost: %s\nContent-Type: %s\n\n%s", server.URL, host, CONTENT_TYPE_FORM, formJson))
+	if err != nil || !strings.Contains(out, `"body":"name= tags="`) {
+		t.Errorf("unmarked json like urlencoded body must be sent as is, got %s, err %v", out, err)
+	}
+}
@@ -1,20 +1,39 @@
 package provider
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
-	"strconv"
-	"strings"
 	"sync"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
 	"github.com/suifengpiao14/templatemap/util"
 )
 
 var DriverName = "mysql"
 
+func init() {
+	MustRegister(PROVIDER_SQL, func(configJson string) (ExecproviderInterface, error) {
+		var config DBExecProviderConfig
+		err := DecodeConfig(configJson, &config)
+		if err != nil {
+			return nil, err
+		}
+		err = validResultMode(config.ResultMode)
+		if err != nil {
+			return nil, err
+		}
+		if config.Dialect != "" {
+			if _, ok := GetDialect(config.Dialect); !ok {
+				err = errors.Errorf("unknown sql dialect %s", config.Dialect)
+				return nil, err
+			}
+		}
+		return &DBExecProvider{Config: config}, nil
+	})
+}
+
 const (
 	SQL_TYPE_SELECT = "SELECT"
 	SQL_TYPE_OTHER  = "OTHER"
@@ -23,10 +42,17 @@ const (
 	LOG_LEVEL_ERROR = "error"
 )
 
+// DBExecProviderConfig 只包含写语句的脚本逐条执行；mysql 包含查询的多语句脚本使用参数化执行时，DSN 需要设置 interpolateParams=true
+// (由驱动转义参数，不使用服务端预处理)，未设置时执行返回错误
+// Dialect 为 mysql(默认)、postgres、sqlite 或 RegisterDialect 注册的方言，DriverName 不为空时覆盖方言的驱动名称
+// ResultMode 为 typed 时按列类型返回 SQLResult json
 type DBExecProviderConfig struct {
-	DSN      string `json:"dsn"`
-	LogLevel string `json:"logLevel"`
-	Timeout  int    `json:"timeout"`
+	DSN        string `json:"dsn"`
+	LogLevel   string `json:"logLevel"`
+	Timeout    int    `json:"timeout"`
+	Dialect    string `json:"dialect"`
+	DriverName string `json:"driverName"`
+	ResultMode string `json:"resultMode"`
 }
 
 type DBExecProvider struct {
@@ -36,13 +62,49 @@ type DBExecProvider struct {
 }
 
 func (p *DBExecProvider) Exec(identifier string, s string) (string, error) {
-	return dbProvider(p, s)
+	return dbProvider(context.Background(), p, s)
+}
+
+func (p *DBExecProvider) ExecContext(ctx context.Context, identifier string, s string) (string, error) {
+	return dbProvider(ctx, p, s)
+}
+
+func (p *DBExecProvider) ExecSQL(ctx context.Context, identifier string, statement string, args ...interface{}) (string, error) {
+	return dbProvider(ctx, p, statement, args...)
 }
 
 func (p *DBExecProvider) GetSource() (source interface{}) {
 	return p.db
 }
 
+// GetDialect 配置的方言，未配置时为 mysql；方言未注册时同样返回 mysql(仅用于渲染 SQL)，执行时返回错误
+func (p *DBExecProvider) GetDialect() SQLDialect {
+	dialect, err := p.dialect()
+	if err != nil {
+		dialect, _ = GetDialect(DIALECT_MYSQL)
+	}
+	return dialect
+}
+
+// dialect 配置的方言，未注册时返回错误
+func (p *DBExecProvider) dialect() (SQLDialect, error) {
+	name := p.Config.Dialect
+	if name == "" {
+		name = DIALECT_MYSQL
+	}
+	dialect, ok := GetDialect(name)
+	if !ok {
+		err := errors.Errorf("unknown sql dialect %s", name)
+		return SQLDialect{}, err
+	}
+	return dialect, nil
+}
+
+// SetDb 使用已有的连接池，需在首次执行前调用
+func (p *DBExecProvider) SetDb(db *sql.DB) {
+	p.db = db
+}
+
 // GetDb is a signal DB
 func (p *DBExecProvider) GetDb() *sql.DB {
 	if p.db == nil {
@@ -51,7 +113,14 @@ func (p *DBExecProvider) GetDb() *sql.DB {
 			panic(err)
 		}
 		p.dbOnce.Do(func() {
-			db, err := sql.Open(DriverName, p.Config.DSN)
+			driverName := p.Config.DriverName
+			if driverName == "" && p.Config.Dialect == "" {
+				driverName = DriverName // 兼容未配置方言时修改全局驱动名称
+			}
+			if driverName == "" {
+				driverName = p.GetDialect().DriverName
+			}
+			db, err := sql.Open(driverName, p.Config.DSN)
 			if err != nil {
 				panic(err)
 			}
@@ -62,39 +131,80 @@ func (p *DBExecProvider) GetDb() *sql.DB {
 	return p.db
 }
 
-//SQLType 判断 sql  属于那种类型
+//SQLType 判断 sql  属于那种类型，脚本中任一语句返回结果集时为 SELECT
 func SQLType(sqls string) string {
-	sqlArr := strings.Split(sqls, EOF)
-	selectLen := len(SQL_TYPE_SELECT)
-	for _, sql := range sqlArr {
-		if len(sql) < selectLen {
-			continue
-		}
-		pre := sql[:selectLen]
-		if strings.ToUpper(pre) == SQL_TYPE_SELECT {
-			return SQL_TYPE_SELECT
-		}
+	dialect, _ := GetDialect(DIALECT_MYSQL)
+	if hasQueryStatement(dialect.SplitStatements(sqls)) {
+		return SQL_TYPE_SELECT
 	}
 	return SQL_TYPE_OTHER
 }
 
-func dbProvider(p *DBExecProvider, sqls string) (string, error) {
-	sqls = util.StandardizeSpaces(util.TrimSpaces(sqls)) // 格式化sql语句
-	sqlType := SQLType(sqls)
+func hasQueryStatement(statements []SQLStatement) bool {
+	for _, statement := range statements {
+		if statement.Query {
+			return true
+		}
+	}
+	return false
+}
+
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// getExecutor ctx 中存在事务时使用事务执行
+func getExecutor(ctx context.Context, p *DBExecProvider) (sqlExecutor, error) {
 	db := p.GetDb()
-	if sqlType != SQL_TYPE_SELECT {
-		res, err := db.Exec(sqls)
+	if txManager, ok := TxManagerFromContext(ctx); ok {
+		return txManager.Tx(db)
+	}
+	return db, nil
+}
+
+// dbProvider 执行 sql，只包含写语句时: 单条语句返回 lastInsertId(大于 0 时) 或 rowsAffected，多条语句返回每条语句的 SQLWriteResult 数组，
+// ResultMode 为 typed 时返回 SQLResult；包含查询语句的脚本整体作为一次查询执行(依赖驱动支持多语句)，只返回查询结果，其中写语句不返回执行结果
+func dbProvider(ctx context.Context, p *DBExecProvider, sqls string, args ...interface{}) (string, error) {
+	dialect, err := p.dialect()
+	if err != nil {
+		return "", err
+	}
+	sqls = util.StandardizeSpaces(dialect.StripComments(util.TrimSpaces(sqls))) // 格式化sql语句，合并空白前删除行注释
+	statements := dialect.SplitStatements(sqls)
+	if len(statements) == 0 {
+		err := errors.Errorf("empty sql")
+		return "", err
+	}
+	if len(statements) > 1 && len(args) > 0 && hasQueryStatement(statements) {
+		err = p.checkInterpolateParams(dialect)
+		if err != nil {
+			return "", err
+		}
+	}
+	db, err := getExecutor(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	typed := p.Config.ResultMode == RESULT_MODE_TYPED
+	if !hasQueryStatement(statements) {
+		results, err := execStatements(ctx, db, dialect, statements, args...)
 		if err != nil {
 			return "", err
 		}
-		lastInsertId, _ := res.LastInsertId()
-		if lastInsertId > 0 {
-			return strconv.FormatInt(lastInsertId, 10), nil
+		if typed {
+			return typedWriteResult(results)
+		}
+		if len(results) == 1 {
+			return results[0].scalar(), nil // 兼容单条写语句直接返回数值
 		}
-		rowsAffected, _ := res.RowsAffected()
-		return strconv.FormatInt(rowsAffected, 10), nil
+		return marshalJSON(results)
+	}
+	sqls = dialect.Prepare(sqls, len(args) > 0)
+	if typed {
+		return typedQuery(ctx, db, dialect, sqls, args...)
 	}
-	rows, err := db.Query(sqls)
+	rows, err := db.QueryContext(ctx, sqls, args...)
 	if err != nil {
 		return "", err
 	}
@@ -110,16 +220,12 @@ func dbProvider(p *DBExecProvider, sqls string) (string, error) {
 		for rows.Next() {
 			var record = make(map[string]interface{})
 			var recordStr = make(map[string]string)
-			err := MapScan(*rows, record)
+			err := MapScan(rows, record)
 			if err != nil {
 				return "", err
 			}
 			for k, v := range record {
-				if v == nil {
-					recordStr[k] = ""
-				} else {
-					recordStr[k] = fmt.Sprintf("%s", v)
-				}
+				recordStr[k] = dialect.FormatValue(v)
 			}
 			records = append(records, recordStr)
 		}
@@ -155,8 +261,73 @@ func dbProvider(p *DBExecProvider, sqls string) (string, error) {
 	return out, nil
 }
 
+// checkInterpolateParams mysql 包含查询的多语句脚本整体执行，使用参数时服务端预处理不支持多语句，DSN 需要设置 interpolateParams=true；
+// 通过 SetDb 设置连接池(DSN 为空)或 DSN 不是 go-sql-driver/mysql 格式时不校验
+func (p *DBExecProvider) checkInterpolateParams(dialect SQLDialect) error {
+	if dialect.Name != DIALECT_MYSQL || p.Config.DSN == "" {
+		return nil
+	}
+	config, err := mysql.ParseDSN(p.Config.DSN)
+	if err != nil {
+		return nil
+	}
+	if !config.InterpolateParams {
+		err = errors.Errorf("mysql multi statement sql with args required interpolateParams=true in dsn")
+		return err
+	}
+	return nil
+}
+
+// execStatements 逐条执行写语句，按占位符数量分配参数，多条语句使用同一连接
+func execStatements(ctx context.Context, db sqlExecutor, dialect SQLDialect, statements []SQLStatement, args ...interface{}) ([]SQLWriteResult, error) {
+	if len(statements) > 1 {
+		if sqlDB, ok := db.(*sql.DB); ok {
+			conn, err := sqlDB.Conn(ctx)
+			if err != nil {
+				return nil, err
+			}
+			defer conn.Close()
+			db = conn
+		}
+	}
+	results := make([]SQLWriteResult, 0, len(statements))
+	offset := 0
+	for _, statement := range statements {
+		statementArgs := args[offset:]
+		if len(statements) > 1 {
+			if offset+statement.Placeholders > len(args) {
+				err := errors.Errorf("sql placeholders more than args(%d): %s", len(args), statement.SQL)
+				return nil, err
+			}
+			statementArgs = args[offset : offset+statement.Placeholders]
+		}
+		offset += statement.Placeholders
+		res, err := db.ExecContext(ctx, dialect.Prepare(statement.SQL, len(statementArgs) > 0), statementArgs...)
+		if err != nil {
+			return nil, err
+		}
+		result := SQLWriteResult{}
+		result.LastInsertId, _ = res.LastInsertId() // postgres 等不支持时为 0
+		result.RowsAffected, _ = res.RowsAffected()
+		results = append(results, result)
+	}
+	if len(statements) > 1 && offset != len(args) {
+		err := errors.Errorf("sql placeholders(%d) not equal args(%d)", offset, len(args))
+		return nil, err
+	}
+	return results, nil
+}
+
+func marshalJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
 //MapScan copy sqlx
-func MapScan(r sql.Rows, dest map[string]interface{}) error {
+func MapScan(r *sql.Rows, dest map[string]interface{}) error {
 	// ignore r.started, since we needn't use reflect for anything.
 	columns, err := r.Columns()
 	if err != nil {
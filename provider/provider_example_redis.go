@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	shellwords "github.com/mattn/go-shellwords"
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/templatemap/util"
+)
+
+func init() {
+	MustRegister(PROVIDER_REDIS, func(configJson string) (ExecproviderInterface, error) {
+		var config RedisExecProviderConfig
+		err := DecodeConfig(configJson, &config)
+		if err != nil {
+			return nil, err
+		}
+		if config.Addr == "" {
+			err = errors.Errorf("redis addr required")
+			return nil, err
+		}
+		return &RedisExecProvider{Config: config}, nil
+	})
+}
+
+type RedisExecProviderConfig struct {
+	Addr     string `json:"addr"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+	Timeout  int    `json:"timeout"`
+}
+
+type RedisExecProvider struct {
+	Config     RedisExecProviderConfig
+	client     *redis.Client
+	clientErr  error
+	clientOnce sync.Once
+}
+
+func (p *RedisExecProvider) Exec(identifier string, s string) (string, error) {
+	return redisProvider(context.Background(), p, s)
+}
+
+func (p *RedisExecProvider) ExecContext(ctx context.Context, identifier string, s string) (string, error) {
+	return redisProvider(ctx, p, s)
+}
+
+func (p *RedisExecProvider) GetSource() (source interface{}) {
+	client, _ := p.GetClient()
+	return client
+}
+
+// GetClient 获取 redis 客户端(单例)，Addr 为空时返回错误
+func (p *RedisExecProvider) GetClient() (*redis.Client, error) {
+	p.clientOnce.Do(func() {
+		if p.Config.Addr == "" {
+			p.clientErr = errors.Errorf("RedisExecProvider addr required")
+			return
+		}
+		p.client = redis.NewClient(&redis.Options{
+			Addr:     p.Config.Addr,
+			Password: p.Config.Password,
+			DB:       p.Config.DB,
+		})
+	})
+	return p.client, p.clientErr
+}
+
+// redisProvider 每行一条 redis 命令(参数解析同 BIN 执行器命令行)，单条命令返回该命令结果的 json，多条命令返回结果数组 json，key 不存在返回 null
+func redisProvider(ctx context.Context, p *RedisExecProvider, input string) (string, error) {
+	input = strings.ReplaceAll(util.TrimSpaces(input), WINDOW_EOF, EOF)
+	commands := make([][]interface{}, 0)
+	for _, line := range strings.Split(input, EOF) {
+		line = util.TrimSpaces(line)
+		if line == "" {
+			continue
+		}
+		args, err := shellwords.Parse(line)
+		if err != nil {
+			err = errors.WithMessagef(err, "parse redis command: %s", line)
+			return "", err
+		}
+		command := make([]interface{}, 0, len(args))
+		for _, arg := range args {
+			command = append(command, arg)
+		}
+		commands = append(commands, command)
+	}
+	if len(commands) == 0 {
+		err := errors.Errorf("redis command required")
+		return "", err
+	}
+	if p.Config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(p.Config.Timeout)*time.Second)
+		defer cancel()
+	}
+	client, err := p.GetClient()
+	if err != nil {
+		return "", err
+	}
+	replies := make([]interface{}, 0, len(commands))
+	for _, command := range commands {
+		reply, err := client.Do(ctx, command...).Result()
+		if err != nil && err != redis.Nil {
+			err = errors.WithMessagef(err, "redis command: %v", command)
+			return "", err
+		}
+		replies = append(replies, reply)
+	}
+	var out interface{} = replies
+	if len(replies) == 1 {
+		out = replies[0]
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisProvider(t *testing.T) {
+	server := miniredis.RunT(t)
+	configJson := fmt.Sprintf(`{"addr":"%s"}`, server.Addr())
+	execProvider, err := MakeExecProvider(PROVIDER_REDIS, configJson)
+	if err != nil {
+		panic(err)
+	}
+	redisExecProvider := execProvider.(*RedisExecProvider)
+	ctx := context.Background()
+
+	input := `
+	SET user:1 '{"name":"张三"}' EX 60
+	GET user:1
+	GET user:2
+	INCRBY counter 3
+	`
+	out, err := redisExecProvider.ExecContext(ctx, "cacheUser", input)
+	if err != nil {
+		panic(err)
+	}
+	want := `["OK","{\"name\":\"张三\"}",null,3]`
+	if out != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+
+	out, err = redisExecProvider.Exec("getUser", "GET user:1")
+	if err != nil {
+		panic(err)
+	}
+	if want := `"{\"name\":\"张三\"}"`; out != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+
+	if _, err = redisExecProvider.Exec("bad", "HGETALL user:1"); err == nil {
+		t.Error("expected WRONGTYPE error")
+	}
+
+	if _, err = MakeExecProvider(PROVIDER_REDIS, `{}`); err == nil {
+		t.Error("expected addr required error")
+	}
+	if _, err = (&RedisExecProvider{}).Exec("getUser", "GET user:1"); err == nil {
+		t.Error("struct literal provider expected addr required error")
+	}
+}
@@ -0,0 +1,189 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	REPLAY_MODE_RECORD = "record" // 调用真实执行器并保存结果
+	REPLAY_MODE_REPLAY = "replay" // 从夹具文件返回结果，不调用真实执行器
+
+	REPLAY_ERROR_HTTP_STATUS = "httpStatus" // *HTTPStatusError，回放时根据 StatusCode 及 Output 重建
+)
+
+// ReplayFixture 一次执行器调用的请求及响应，ErrorType 为空时错误回放为普通错误
+type ReplayFixture struct {
+	Input      string `json:"input"`
+	Output     string `json:"output"`
+	Error      string `json:"error,omitempty"`
+	ErrorType  string `json:"errorType,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty"`
+}
+
+// ReplayExecProvider 录制回放执行器，夹具文件为 <Dir>/<模板名称>.json，内容为 输入hash -> ReplayFixture；
+// SQL 模板的输入为拼接参数后的 SQL(同容器中 <name>SQL)
+type ReplayExecProvider struct {
+	Mode     string
+	Dir      string
+	Provider ExecproviderInterface // 真实执行器，回放模式下不调用
+	lock     sync.Mutex
+	fixtures map[string]map[string]ReplayFixture
+}
+
+// NewReplayExecProvider 创建录制回放执行器，execProvider 为 SQL 执行器时返回值实现 SQLExecproviderInterface
+func NewReplayExecProvider(mode string, dir string, execProvider ExecproviderInterface) ExecproviderInterface {
+	p := &ReplayExecProvider{
+		Mode:     mode,
+		Dir:      dir,
+		Provider: execProvider,
+		fixtures: make(map[string]map[string]ReplayFixture),
+	}
+	if _, ok := execProvider.(SQLExecproviderInterface); ok {
+		return &replaySQLExecProvider{p}
+	}
+	return p
+}
+
+func (p *ReplayExecProvider) Exec(identifier string, s string) (string, error) {
+	return p.ExecContext(context.Background(), identifier, s)
+}
+
+func (p *ReplayExecProvider) ExecContext(ctx context.Context, identifier string, s string) (string, error) {
+	return p.replay(identifier, s, func() (string, error) {
+		return ExecWithContext(ctx, p.Provider, identifier, s)
+	})
+}
+
+func (p *ReplayExecProvider) GetSource() (source interface{}) {
+	return p.Provider.GetSource()
+}
+
+// ReplayHash 输入的 hash，作为夹具文件中的键
+func ReplayHash(input string) string {
+	sum := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (p *ReplayExecProvider) replay(identifier string, input string, exec func() (string, error)) (string, error) {
+	hash := ReplayHash(input)
+	if p.Mode == REPLAY_MODE_RECORD {
+		out, execErr := exec()
+		fixture := ReplayFixture{Input: input, Output: out}
+		if execErr != nil {
+			fixture.Error = execErr.Error()
+			var statusError *HTTPStatusError
+			if errors.As(execErr, &statusError) {
+				fixture.ErrorType = REPLAY_ERROR_HTTP_STATUS
+				fixture.StatusCode = statusError.StatusCode
+			}
+		}
+		err := p.save(identifier, hash, fixture)
+		if err != nil {
+			return "", err
+		}
+		return out, execErr
+	}
+	if p.Mode != REPLAY_MODE_REPLAY {
+		err := errors.Errorf("replay mode want %s or %s, got %s", REPLAY_MODE_RECORD, REPLAY_MODE_REPLAY, p.Mode)
+		return "", err
+	}
+	fixtures, err := p.load(identifier)
+	if err != nil {
+		return "", err
+	}
+	fixture, ok := fixtures[hash]
+	if !ok {
+		err = errors.Errorf("replay fixture not found, template: %s, hash: %s, input: %s", identifier, hash, input)
+		return "", err
+	}
+	if fixture.Error != "" {
+		return fixture.Output, fixture.replayError()
+	}
+	return fixture.Output, nil
+}
+
+// replayError 还原录制时的错误，调用方可按录制时的错误类型判断
+func (fixture ReplayFixture) replayError() error {
+	if fixture.ErrorType == REPLAY_ERROR_HTTP_STATUS {
+		rspData := &ResponseData{}
+		err := json.Unmarshal([]byte(fixture.Output), rspData)
+		if err != nil {
+			err = errors.WithMessagef(err, "replay http status response %s", fixture.Output)
+			return err
+		}
+		return errors.WithStack(&HTTPStatusError{StatusCode: fixture.StatusCode, Response: rspData})
+	}
+	return errors.New(fixture.Error)
+}
+
+func (p *ReplayExecProvider) fixtureFile(identifier string) string {
+	return filepath.Join(p.Dir, identifier+".json")
+}
+
+func (p *ReplayExecProvider) load(identifier string) (map[string]ReplayFixture, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.loadLocked(identifier)
+}
+
+func (p *ReplayExecProvider) loadLocked(identifier string) (map[string]ReplayFixture, error) {
+	if fixtures, ok := p.fixtures[identifier]; ok {
+		return fixtures, nil
+	}
+	fixtures := make(map[string]ReplayFixture)
+	b, err := os.ReadFile(p.fixtureFile(identifier))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(b) > 0 {
+		err = json.Unmarshal(b, &fixtures)
+		if err != nil {
+			err = errors.WithMessagef(err, "replay fixture file %s", p.fixtureFile(identifier))
+			return nil, err
+		}
+	}
+	p.fixtures[identifier] = fixtures
+	return fixtures, nil
+}
+
+func (p *ReplayExecProvider) save(identifier string, hash string, fixture ReplayFixture) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	fixtures, err := p.loadLocked(identifier)
+	if err != nil {
+		return err
+	}
+	fixtures[hash] = fixture
+	b, err := json.MarshalIndent(fixtures, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(p.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p.fixtureFile(identifier), append(b, '\n'), 0o644)
+}
+
+type replaySQLExecProvider struct {
+	*ReplayExecProvider
+}
+
+func (p *replaySQLExecProvider) ExecSQL(ctx context.Context, identifier string, statement string, args ...interface{}) (string, error) {
+	sql := p.GetDialect().ExplainSQL(statement, args...)
+	return p.replay(identifier, sql, func() (string, error) {
+		return p.Provider.(SQLExecproviderInterface).ExecSQL(ctx, identifier, statement, args...)
+	})
+}
+
+func (p *replaySQLExecProvider) GetDialect() SQLDialect {
+	return DialectOf(p.Provider)
+}
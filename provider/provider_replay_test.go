@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestReplayExecProvider(t *testing.T) {
+	dir := t.TempDir()
+	recorder := NewReplayExecProvider(REPLAY_MODE_RECORD, dir, &echoExecProvider{Prefix: "echo:"})
+	for _, input := range []string{"a", "b"} {
+		out, err := recorder.Exec("echo", input)
+		if err != nil {
+			panic(err)
+		}
+		if out != "echo:"+input {
+			t.Errorf("record got %s", out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "echo.json")); err != nil {
+		t.Fatalf("fixture file not written: %v", err)
+	}
+
+	replayer := NewReplayExecProvider(REPLAY_MODE_REPLAY, dir, &echoExecProvider{Prefix: "live:"})
+	out, err := replayer.Exec("echo", "b")
+	if err != nil {
+		panic(err)
+	}
+	if out != "echo:b" {
+		t.Errorf("replay got %s, want recorded output echo:b", out)
+	}
+	if _, err = replayer.Exec("echo", "c"); err == nil {
+		t.Error("expected fixture not found error")
+	}
+	if _, ok := replayer.(SQLExecproviderInterface); ok {
+		t.Error("replay provider of non SQL provider must not implement SQLExecproviderInterface")
+	}
+	if _, ok := NewReplayExecProvider(REPLAY_MODE_REPLAY, dir, &DBExecProvider{}).(SQLExecproviderInterface); !ok {
+		t.Error("replay provider of SQL provider must implement SQLExecproviderInterface")
+	}
+}
+
+func TestReplayExecProviderHTTPStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "not found")
+	}))
+	dir := t.TempDir()
+	raw := fmt.Sprintf("GET %s/user HTTP/1.1\nHost: %s\n", server.URL, strings.TrimPrefix(server.URL, "http://"))
+	recorder := NewReplayExecProvider(REPLAY_MODE_RECORD, dir, &CURLExecProvider{})
+	recordOut, err := recorder.Exec("getUser", raw)
+	var statusError *HTTPStatusError
+	if !errors.As(err, &statusError) {
+		t.Fatalf("record expected HTTPStatusError, got %v", err)
+	}
+	server.Close() // 回放不再请求服务端
+
+	replayer := NewReplayExecProvider(REPLAY_MODE_REPLAY, dir, &CURLExecProvider{})
+	out, err := replayer.Exec("getUser", raw)
+	statusError = nil
+	if !errors.As(err, &statusError) || statusError.StatusCode != http.StatusNotFound || statusError.Response.Body != "not found" {
+		t.Fatalf("replay expected HTTPStatusError 404, got %v", err)
+	}
+	if out != recordOut {
+		t.Errorf("replay got %s, want %s", out, recordOut)
+	}
+}
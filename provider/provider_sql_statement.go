@@ -0,0 +1,247 @@
+package provider
+
+import (
+	"strings"
+)
+
+const (
+	sqlTokenWord = iota
+	sqlTokenQuoted
+	sqlTokenComment
+	sqlTokenPunct
+)
+
+type sqlToken struct {
+	Kind  int
+	Text  string
+	Start int
+	End   int
+}
+
+// 返回结果集的语句关键字，WITH 按其主语句判断，语句中包含 RETURNING 时同样返回结果集
+var querySQLKeywords = map[string]bool{
+	"SELECT":   true,
+	"SHOW":     true,
+	"EXPLAIN":  true,
+	"DESCRIBE": true,
+	"DESC":     true,
+	"PRAGMA":   true,
+	"VALUES":   true,
+	"TABLE":    true,
+}
+
+// SQLStatement 脚本中的一条语句
+type SQLStatement struct {
+	SQL          string
+	Keyword      string // 主语句关键字(大写)，如 SELECT、INSERT，WITH 语句为其主语句关键字
+	Query        bool   // 是否返回结果集
+	Placeholders int    // ? 占位符数量
+}
+
+// lexSQL 按方言拆分词法单元，字符串、引用标识符、注释作为整体
+func (d SQLDialect) lexSQL(s string) []sqlToken {
+	tokens := make([]sqlToken, 0)
+	for i := 0; i < len(s); {
+		c := s[i]
+		start := i
+		kind := sqlTokenPunct
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			kind = sqlTokenQuoted
+			i = d.quotedEnd(s, i)
+		case c == '-' && strings.HasPrefix(s[i:], "--") && (i+2 == len(s) || strings.ContainsRune(" \t\r\n", rune(s[i+2]))),
+			c == '#' && d.Name == DIALECT_MYSQL:
+			kind = sqlTokenComment
+			i = strings.IndexByte(s[i:], '\n')
+			if i < 0 {
+				i = len(s)
+			} else {
+				i += start + 1
+			}
+		case c == '/' && strings.HasPrefix(s[i:], "/*") && !strings.HasPrefix(s[i:], "/*!") && !strings.HasPrefix(s[i:], "/*+"):
+			kind = sqlTokenComment
+			i = strings.Index(s[i+2:], "*/")
+			if i < 0 {
+				i = len(s)
+			} else {
+				i += start + 4
+			}
+		case c == '$' && dollarTag(s[i:]) != "":
+			kind = sqlTokenQuoted
+			tag := dollarTag(s[i:])
+			i = strings.Index(s[start+len(tag):], tag)
+			if i < 0 {
+				i = len(s)
+			} else {
+				i += start + 2*len(tag)
+			}
+		case isSQLWordByte(c):
+			kind = sqlTokenWord
+			for i < len(s) && isSQLWordByte(s[i]) {
+				i++
+			}
+		default:
+			i++
+		}
+		tokens = append(tokens, sqlToken{Kind: kind, Text: s[start:i], Start: start, End: i})
+	}
+	return tokens
+}
+
+// quotedEnd 返回从 start 开始的字符串或引用标识符的结束位置，引号重复两次视为转义
+func (d SQLDialect) quotedEnd(s string, start int) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && quote != '`' && d.BackslashEscape {
+			i++
+			continue
+		}
+		if c == quote {
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// dollarTag postgres 美元引用字符串的开始标记，如 $$、$body$，$1 等占位符返回空字符串
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '$' {
+			return s[:i+1]
+		}
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 1 && c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
+
+func isSQLWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// StripComments 删除注释(保留 mysql /*! */ 及优化器提示 /*+ */)，用于合并空白前去除行注释
+func (d SQLDialect) StripComments(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, token := range d.lexSQL(s) {
+		if token.Kind != sqlTokenComment {
+			continue
+		}
+		b.WriteString(s[last:token.Start])
+		b.WriteString(" ")
+		last = token.End
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// SplitStatements 按 ; 拆分脚本(忽略字符串、标识符及注释中的 ;)，并判断每条语句的类型
+func (d SQLDialect) SplitStatements(sqls string) []SQLStatement {
+	statements := make([]SQLStatement, 0)
+	tokens := d.lexSQL(sqls)
+	begin := 0
+	for i, token := range tokens {
+		if token.Kind == sqlTokenPunct && token.Text == ";" {
+			statements = appendSQLStatement(statements, sqls, tokens[begin:i])
+			begin = i + 1
+		}
+	}
+	return appendSQLStatement(statements, sqls, tokens[begin:])
+}
+
+func appendSQLStatement(statements []SQLStatement, sqls string, tokens []sqlToken) []SQLStatement {
+	code := make([]sqlToken, 0, len(tokens))
+	for _, token := range tokens {
+		if token.Kind != sqlTokenComment {
+			code = append(code, token)
+		}
+	}
+	if len(code) == 0 {
+		return statements
+	}
+	statement := SQLStatement{
+		SQL:     sqls[code[0].Start:code[len(code)-1].End],
+		Keyword: mainSQLKeyword(code),
+	}
+	statement.Query = querySQLKeywords[statement.Keyword]
+	for _, token := range code {
+		switch {
+		case token.Kind == sqlTokenPunct && token.Text == "?":
+			statement.Placeholders++
+		case token.Kind == sqlTokenWord && strings.EqualFold(token.Text, "RETURNING"):
+			statement.Query = true
+		}
+	}
+	return append(statements, statement)
+}
+
+// mainSQLKeyword 跳过开头的括号及 WITH 子句，返回主语句关键字
+func mainSQLKeyword(tokens []sqlToken) string {
+	i := 0
+	for i < len(tokens) && tokens[i].Text == "(" {
+		i++
+	}
+	if i == len(tokens) {
+		return ""
+	}
+	keyword := strings.ToUpper(tokens[i].Text)
+	if keyword != "WITH" {
+		return keyword
+	}
+	i++
+	if i < len(tokens) && strings.EqualFold(tokens[i].Text, "RECURSIVE") {
+		i++
+	}
+	for i < len(tokens) {
+		i++ // 跳过 CTE 名称及列名
+		if i < len(tokens) && tokens[i].Text == "(" {
+			i = skipSQLParen(tokens, i)
+		}
+		for i < len(tokens) && tokens[i].Text != "(" { // AS [NOT] MATERIALIZED
+			i++
+		}
+		i = skipSQLParen(tokens, i)
+		if i < len(tokens) && tokens[i].Text == "," {
+			i++
+			continue
+		}
+		break
+	}
+	for i < len(tokens) && tokens[i].Text == "(" {
+		i++
+	}
+	if i >= len(tokens) {
+		return keyword
+	}
+	return strings.ToUpper(tokens[i].Text)
+}
+
+// skipSQLParen tokens[i] 为 ( 时返回匹配的 ) 之后的位置
+func skipSQLParen(tokens []sqlToken, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i].Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	mysql, _ := GetDialect(DIALECT_MYSQL)
+	cases := []struct {
+		sql     string
+		keyword string
+		query   bool
+	}{
+		{"select * from `user`", "SELECT", true},
+		{"  (select 1) union (select 2)", "SELECT", true},
+		{"-- 查询用户\nselect * from `user`", "SELECT", true},
+		{"/* 查询 */ SHOW TABLES", "SHOW", true},
+		{"# mysql 注释\nexplain select 1", "EXPLAIN", true},
+		{"desc `user`", "DESC", true},
+		{"pragma table_info(`user`)", "PRAGMA", true},
+		{"with recursive `t` (`n`) as (select 1 union all select `n`+1 from `t` where `n`<3) select * from `t`", "SELECT", true},
+		{"WITH a AS (select 1), b AS MATERIALIZED (select 2) update `user` set `name`='a' where `id` in (select * from a)", "UPDATE", false},
+		{"insert into `user` (`name`) values ('select')", "INSERT", false},
+		{"insert into `user` (`name`) values (?) returning `id`", "INSERT", true},
+		{"update `user` set `name`=? where `id`=?", "UPDATE", false},
+		{"replace into `user` values (1,'a')", "REPLACE", false},
+	}
+	for _, c := range cases {
+		statements := mysql.SplitStatements(c.sql)
+		if len(statements) != 1 {
+			t.Errorf("%s got %d statements", c.sql, len(statements))
+			continue
+		}
+		if statements[0].Keyword != c.keyword || statements[0].Query != c.query {
+			t.Errorf("%s got %s %v, want %s %v", c.sql, statements[0].Keyword, statements[0].Query, c.keyword, c.query)
+		}
+	}
+
+	script := "insert into `user` (`name`) values ('a;b?');\n-- ; 注释\nupdate `user` set `name`=? where `id`=? /* ? */;\n"
+	statements := mysql.SplitStatements(script)
+	if len(statements) != 2 {
+		t.Fatalf("got %d statements: %#v", len(statements), statements)
+	}
+	if statements[0].SQL != "insert into `user` (`name`) values ('a;b?')" || statements[0].Placeholders != 0 {
+		t.Errorf("first statement got %#v", statements[0])
+	}
+	if statements[1].SQL != "update `user` set `name`=? where `id`=?" || statements[1].Placeholders != 2 {
+		t.Errorf("second statement got %#v", statements[1])
+	}
+	if SQLType(script) != SQL_TYPE_OTHER || SQLType("insert into `t` values (1);\nSELECT last_insert_id()") != SQL_TYPE_SELECT {
+		t.Error("SQLType want OTHER for write script and SELECT for script with query")
+	}
+
+	postgres, _ := GetDialect(DIALECT_POSTGRES)
+	if got := postgres.StripComments("select $$ -- ; $$ as a -- note\n, 'b' # 1"); got != "select $$ -- ; $$ as a  , 'b' # 1" {
+		t.Errorf("postgres StripComments got %q", got)
+	}
+}
+
+func TestDBExecProviderWriteResult(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	_, err = db.Exec("create table `user` (`id` integer primary key autoincrement, `name` text)")
+	if err != nil {
+		panic(err)
+	}
+	execProvider := &DBExecProvider{Config: DBExecProviderConfig{Dialect: DIALECT_SQLITE}}
+	execProvider.SetDb(db)
+	ctx := context.Background()
+	out, err := execProvider.ExecSQL(ctx, "insertUser", "-- 新增\ninsert into `user` (`name`) values (?)", "a")
+	if err != nil {
+		panic(err)
+	}
+	if want := "1"; out != want {
+		t.Errorf("single statement got %s, want lastInsertId %s", out, want)
+	}
+
+	script := "insert into `user` (`name`) values (?),(?); update `user` set `name`=? where `id`<=?;"
+	out, err = execProvider.ExecSQL(ctx, "batch", script, "b", "c", "x", 2)
+	if err != nil {
+		panic(err)
+	}
+	if want := `[{"lastInsertId":3,"rowsAffected":2},{"lastInsertId":3,"rowsAffected":2}]`; out != want {
+		t.Errorf("script got %s, want %s", out, want)
+	}
+	if _, err = execProvider.ExecSQL(ctx, "batch", script, "b"); err == nil {
+		t.Error("expected placeholders more than args error")
+	}
+
+	execProvider.Config.ResultMode = RESULT_MODE_TYPED
+	out, err = execProvider.ExecSQL(ctx, "batch", "delete from `user` where `id`=?; delete from `user` where `id`>?", 1, 2)
+	if err != nil {
+		panic(err)
+	}
+	want := `{"columns":[],"rows":[],"rowsAffected":2,"lastInsertId":3,"statements":[{"lastInsertId":3,"rowsAffected":1},{"lastInsertId":3,"rowsAffected":1}]}`
+	if out != want {
+		t.Errorf("typed script got %s, want %s", out, want)
+	}
+	mysqlProvider := &DBExecProvider{Config: DBExecProviderConfig{DSN: "root:123456@tcp(127.0.0.1:3306)/test?multiStatements=true"}}
+	_, err = mysqlProvider.ExecSQL(ctx, "insertGetUser", "insert into `user` (`name`) values (?); select * from `user` where `name`=?", "a", "a")
+	if err == nil || !strings.Contains(err.Error(), "interpolateParams") {
+		t.Errorf("expected interpolateParams required error, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"sort"
+	"testing"
+)
+
+type echoExecProvider struct {
+	Prefix string `json:"prefix"`
+}
+
+func (p *echoExecProvider) Exec(identifier string, s string) (string, error) {
+	return p.Prefix + s, nil
+}
+
+func (p *echoExecProvider) GetSource() (source interface{}) {
+	return nil
+}
+
+func TestRegister(t *testing.T) {
+	identifier := "ECHO"
+	err := Register(identifier, func(configJson string) (ExecproviderInterface, error) {
+		p := &echoExecProvider{}
+		err := DecodeConfig(configJson, p)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = Register(identifier, func(configJson string) (ExecproviderInterface, error) { return nil, nil })
+	if err == nil {
+		t.Error("expected duplicate registration error")
+	}
+	providers := Providers()
+	if !sort.StringsAreSorted(providers) {
+		t.Errorf("Providers not sorted: %v", providers)
+	}
+	for _, want := range []string{PROVIDER_BIN, PROVIDER_CURL, PROVIDER_SQL, identifier} {
+		if sort.SearchStrings(providers, want) == len(providers) || providers[sort.SearchStrings(providers, want)] != want {
+			t.Errorf("Providers %v missing %s", providers, want)
+		}
+	}
+
+	execProvider, err := MakeExecProvider(identifier, `{"prefix":"echo:"}`)
+	if err != nil {
+		panic(err)
+	}
+	out, err := execProvider.Exec(identifier, "hello")
+	if err != nil {
+		panic(err)
+	}
+	if out != "echo:hello" {
+		t.Errorf("got %s", out)
+	}
+	if _, err = MakeExecProvider(PROVIDER_SQL, `{"dsn":1}`); err == nil {
+		t.Error("expected config decode error")
+	}
+	if _, err = MakeExecProvider("UNKNOWN", ""); err == nil {
+		t.Error("expected not registered error")
+	}
+}
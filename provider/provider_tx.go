@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type txManagerContextKey struct{}
+
+// TxManager 一次事务内各数据库共用的 *sql.Tx，首次在某数据库执行 SQL 时开启事务
+// 提交多个数据库时逐个提交，不保证跨库原子性；同一事务内并发执行 SQL 会在同一连接上串行
+type TxManager struct {
+	parent context.Context
+	ctx    context.Context
+	lock   sync.Mutex
+	txMap  map[*sql.DB]*sql.Tx
+	done   bool
+}
+
+// NewTxManager 创建事务，返回的 Context() 传递给执行器后，执行器使用事务执行 SQL
+func NewTxManager(parent context.Context) *TxManager {
+	m := &TxManager{
+		parent: parent,
+		txMap:  make(map[*sql.DB]*sql.Tx),
+	}
+	m.ctx = context.WithValue(parent, txManagerContextKey{}, m)
+	return m
+}
+
+// TxManagerFromContext 获取 ctx 中的事务
+func TxManagerFromContext(ctx context.Context) (*TxManager, bool) {
+	m, ok := ctx.Value(txManagerContextKey{}).(*TxManager)
+	return m, ok
+}
+
+// Context 携带事务的上下文
+func (m *TxManager) Context() context.Context {
+	return m.ctx
+}
+
+// Parent 开启事务前的上下文，提交或回滚后恢复使用
+func (m *TxManager) Parent() context.Context {
+	return m.parent
+}
+
+// Tx 获取 db 对应的事务，不存在时开启
+func (m *TxManager) Tx(db *sql.DB) (*sql.Tx, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.done {
+		err := errors.Errorf("transaction has already been committed or rolled back")
+		return nil, err
+	}
+	if tx, ok := m.txMap[db]; ok {
+		return tx, nil
+	}
+	tx, err := db.BeginTx(m.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	m.txMap[db] = tx
+	return tx, nil
+}
+
+// Commit 提交全部事务，返回第一个错误
+func (m *TxManager) Commit() error {
+	return m.finish(func(tx *sql.Tx) error {
+		return tx.Commit()
+	})
+}
+
+// Rollback 回滚全部事务，忽略已结束的事务
+func (m *TxManager) Rollback() error {
+	return m.finish(func(tx *sql.Tx) error {
+		err := tx.Rollback()
+		if errors.Is(err, sql.ErrTxDone) {
+			return nil
+		}
+		return err
+	})
+}
+
+func (m *TxManager) finish(fn func(tx *sql.Tx) error) (err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.done {
+		err = errors.Errorf("transaction has already been committed or rolled back")
+		return err
+	}
+	m.done = true
+	for _, tx := range m.txMap {
+		if txErr := fn(tx); txErr != nil && err == nil {
+			err = txErr
+		}
+	}
+	return err
+}
@@ -2,11 +2,13 @@ package templatemap
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/fs"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 
 	"encoding/json"
@@ -16,12 +18,17 @@ import (
 	"github.com/suifengpiao14/templatemap/provider"
 	"github.com/suifengpiao14/templatemap/util"
 	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
 	"github.com/xeipuuv/gojsonschema"
 )
 
 const (
 	TPlSuffix             = ".tpl"
 	REPOSITORY_KEY        = "__repository"
+	CONTEXT_KEY           = "__context"
+	HEADER_KEY            = "__header"
+	CLEANUP_KEY           = "__cleanup"
+	RESERVED_KEY_PREFIX   = "__" // 容器内部使用的键前缀，Invoke 不将输入中以此开头的属性写入容器
 	LOGGER_LEVEL_DEBUGGER = "debugger"
 	LOGGER_LEVEL_INFO     = "info"
 	LOGGER_LEVEL_WARNING  = "warning"
@@ -30,6 +37,11 @@ const (
 
 var LOGGER_LEVEL = LOGGER_LEVEL_DEBUGGER
 
+const DEFAULT_PARALLEL_LIMIT = 10
+
+const SQL_STREAM_BATCH_SIZE = 100 // execSQLStream 默认每批记录数
+
+// VolumeInterface 模板数据容器，NewVolume 创建的容器非并发安全，多协程共享容器时使用 NewSyncVolume
 type VolumeInterface interface {
 	SetValue(key string, value interface{})
 	GetValue(key string, value interface{}) (ok bool)
@@ -120,8 +132,12 @@ func getValue(v *volumeMap, key string) (interface{}, bool) {
 	// json key 获取值
 	jsonKey = key[len(mapKey)+1:]
 	jsonStr, ok := value.(string)
-	if !ok {
-		return nil, false
+	if !ok { // 非 json 字符串(如 Invoke 写入的对象)，转换为 json 后获取
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, false
+		}
+		jsonStr = string(b)
 	}
 	jsonValue, ok := GetValueFromJson(jsonStr, jsonKey)
 	return jsonValue, ok
@@ -226,9 +242,12 @@ type LineschemaMeta struct {
 }
 
 type TemplateMeta struct {
-	Name           string
-	ExecProvider   provider.ExecproviderInterface
-	LineschemaMeta *LineschemaMeta
+	Name                 string
+	ExecProvider         provider.ExecproviderInterface
+	LineschemaMeta       *LineschemaMeta // 输入数据元数据
+	OutputLineschemaMeta *LineschemaMeta // 输出数据元数据
+	Method               string          // http 接口请求方法，为空时不限制
+	Path                 string          // http 接口路径，为空时不发布为 http 接口
 }
 
 type RepositoryInterface interface {
@@ -237,20 +256,48 @@ type RepositoryInterface interface {
 	AddTemplateByStr(name string, s string) (addTplNames []string)
 	GetTemplate() *template.Template
 	ExecuteTemplate(name string, volume VolumeInterface) (string, error)
+	ExecuteTemplateContext(ctx context.Context, name string, volume VolumeInterface) (string, error)
+	Invoke(apiName string, input string) (string, error)
+	InvokeContext(ctx context.Context, apiName string, input string) (string, error)
 	TemplateExists(name string) bool
 	RegisterMeta(tplName string, meta *TemplateMeta)
 	GetMeta(tplName string) (*TemplateMeta, bool)
+	GetMetas() map[string]*TemplateMeta
+	ParallelLimit() int
 }
 
 type repository struct {
-	template *template.Template
-	metaMap  map[string]*TemplateMeta
+	template        *template.Template
+	metaMap         map[string]*TemplateMeta
+	parallelLimit   int
+	captureProvider *provider.CaptureExecProvider
+}
+
+// RepositoryOption 仓库配置项
+type RepositoryOption func(r *repository)
+
+// WithParallelLimit 设置 execParallel 同时执行的模板数量，limit<1 时不限制
+func WithParallelLimit(limit int) RepositoryOption {
+	return func(r *repository) {
+		r.parallelLimit = limit
+	}
 }
 
-func NewRepository() RepositoryInterface {
+// WithCaptureProvider 记录模式，注册模板元数据时将执行器替换为 capture，不访问真实的数据库及服务
+func WithCaptureProvider(capture *provider.CaptureExecProvider) RepositoryOption {
+	return func(r *repository) {
+		r.captureProvider = capture
+	}
+}
+
+func NewRepository(options ...RepositoryOption) RepositoryInterface {
 	r := &repository{
-		template: newTemplate(),
-		metaMap:  make(map[string]*TemplateMeta),
+		template:      newTemplate(),
+		metaMap:       make(map[string]*TemplateMeta),
+		parallelLimit: DEFAULT_PARALLEL_LIMIT,
+	}
+	for _, option := range options {
+		option(r)
 	}
 	return r
 }
@@ -260,6 +307,11 @@ func newTemplate() *template.Template {
 }
 
 func (r *repository) RegisterMeta(tplName string, meta *TemplateMeta) {
+	if r.captureProvider != nil && meta != nil && meta.ExecProvider != nil {
+		captureMeta := *meta // 不修改调用方的元数据
+		captureMeta.ExecProvider = r.captureProvider.Wrap(meta.ExecProvider)
+		meta = &captureMeta
+	}
 	r.metaMap[tplName] = meta
 }
 
@@ -268,6 +320,19 @@ func (r *repository) GetMeta(tplName string) (*TemplateMeta, bool) {
 	return meta, ok
 }
 
+// GetMetas 全部模板元数据，key 为模板名称
+func (r *repository) GetMetas() map[string]*TemplateMeta {
+	out := make(map[string]*TemplateMeta, len(r.metaMap))
+	for tplName, meta := range r.metaMap {
+		out[tplName] = meta
+	}
+	return out
+}
+
+func (r *repository) ParallelLimit() int {
+	return r.parallelLimit
+}
+
 func (r *repository) GetTemplate() *template.Template {
 	return r.template
 }
@@ -314,27 +379,271 @@ func (r *repository) AddTemplateByStr(name string, s string) []string {
 	return out
 }
 
+// ExecuteTemplate 使用容器中已有的上下文执行模板，容器未设置上下文时使用 context.Background()
 func (r *repository) ExecuteTemplate(name string, volume VolumeInterface) (string, error) {
+	volume, err := r.initVolume(volume)
+	if err != nil {
+		return "", err
+	}
+	ctx := getContextFromVolume(volume)
+	return r.executeTemplate(ctx, name, volume)
+}
+
+// ExecuteTemplateContext 执行模板，ctx 写入容器，模板内的执行器调用(execSQLTpl、execCURLTpl、execBinTpl)共用该上下文
+func (r *repository) ExecuteTemplateContext(ctx context.Context, name string, volume VolumeInterface) (string, error) {
+	volume, err := r.initVolume(volume)
+	if err != nil {
+		return "", err
+	}
+	volume.SetValue(CONTEXT_KEY, ctx)
+	return r.executeTemplate(ctx, name, volume)
+}
+
+// Invoke 执行 api 模板，流程: 格式化输入、校验输入、初始化容器、执行模板、格式化输出
+func (r *repository) Invoke(apiName string, input string) (string, error) {
+	return r.InvokeContext(context.Background(), apiName, input)
+}
+
+type headerContextKey struct{}
+
+// ContextWithHeader 设置请求头，InvokeContext 将其写入容器 HEADER_KEY
+func ContextWithHeader(ctx context.Context, header map[string]string) context.Context {
+	return context.WithValue(ctx, headerContextKey{}, header)
+}
+
+// HeaderFromContext 获取 ContextWithHeader 设置的请求头
+func HeaderFromContext(ctx context.Context) (map[string]string, bool) {
+	header, ok := ctx.Value(headerContextKey{}).(map[string]string)
+	return header, ok
+}
+
+// InvokeContext 同 Invoke，ctx 用于模板内的执行器调用，ctx 中的请求头(ContextWithHeader)写入容器 HEADER_KEY；
+// 输入元数据为 TemplateMeta.LineschemaMeta，校验失败返回 *util.ValidateError，设置了 dst 的属性写入容器对应路径，其余顶层属性按名称写入容器(忽略 RESERVED_KEY_PREFIX 开头的属性)；
+// 输出元数据为 TemplateMeta.OutputLineschemaMeta，按 src 从容器获取数据，未设置时返回模板输出
+func (r *repository) InvokeContext(ctx context.Context, apiName string, input string) (out string, err error) {
+	defer func() {
+		if panicInfo := recover(); panicInfo != nil {
+			out, err = "", recoverError(panicInfo) // json schema 解析失败时 panic
+		}
+	}()
+	if !r.TemplateExists(apiName) {
+		err = errors.Errorf("api template %s not found", apiName)
+		return "", err
+	}
+	var inputMeta, outputMeta *LineschemaMeta
+	if meta, ok := r.GetMeta(apiName); ok {
+		inputMeta, outputMeta = meta.LineschemaMeta, meta.OutputLineschemaMeta
+	}
+	input, err = formatInput(input, inputMeta)
+	if err != nil {
+		return "", err
+	}
+	volume := NewVolume(r)
+	SetInputToVolume(volume, input, inputMeta)
+	if header, ok := HeaderFromContext(ctx); ok {
+		volume.SetValue(HEADER_KEY, header)
+	}
+	out, err = r.ExecuteTemplateContext(ctx, apiName, volume)
+	if err != nil {
+		return "", err
+	}
+	if outputMeta == nil || outputMeta.JsonSchema == "" {
+		return out, nil
+	}
+	transferPaths := NewJsonSchema(outputMeta.JsonSchema).GetTransferPaths()
+	out, err = TransferDataFromVolume(volume, transferPaths)
+	if err != nil {
+		return "", err
+	}
+	return FormatJson(out, outputMeta.JsonSchema)
+}
+
+// formatInput 填充默认值后校验输入，校验通过后为缺失的字段设置类型初始化值
+func formatInput(input string, meta *LineschemaMeta) (string, error) {
+	if util.TrimSpaces(input) == "" {
+		input = "{}"
+	}
+	if !gjson.Valid(input) {
+		return "", newInputError("invalid_json", "Invalid JSON")
+	}
+	if meta == nil {
+		return input, nil
+	}
+	input, err := mergeDefaultJson(input, meta.DefaultJson)
+	if err != nil {
+		return "", err
+	}
+	if meta.SchemaLoader != nil {
+		err = util.Validate(input, *meta.SchemaLoader)
+	} else if meta.JsonSchema != "" {
+		err = util.Validate(input, gojsonschema.NewStringLoader(meta.JsonSchema))
+	}
+	if err != nil {
+		return "", err
+	}
+	if meta.JsonSchema == "" {
+		return input, nil
+	}
+	return FormatJson(input, meta.JsonSchema)
+}
+
+// mergeDefaultJson 将默认值中输入不存在的路径写入输入
+func mergeDefaultJson(input string, defaultJson string) (out string, err error) {
+	out = input
+	if defaultJson == "" {
+		return out, nil
+	}
+	var merge func(prefix string, defaults gjson.Result)
+	merge = func(prefix string, defaults gjson.Result) {
+		defaults.ForEach(func(key, value gjson.Result) bool {
+			path := key.String()
+			if prefix != "" {
+				path = prefix + "." + path
+			}
+			current := gjson.Get(out, path)
+			if current.IsObject() && value.IsObject() {
+				merge(path, value)
+				return err == nil
+			}
+			if !current.Exists() {
+				out, err = sjson.SetRaw(out, path, value.Raw)
+			}
+			return err == nil
+		})
+	}
+	merge("", gjson.Parse(defaultJson))
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// SetInputToVolume 将 json 对象输入写入容器，忽略 __ 开头的保留键，meta 不为 nil 时按 json schema 转换路径
+func SetInputToVolume(volume VolumeInterface, input string, meta *LineschemaMeta) {
+	transferPaths := TransferPaths{}
+	var schema *Schema
+	if meta != nil && meta.JsonSchema != "" {
+		schema = NewJsonSchema(meta.JsonSchema)
+		transferPaths = schema.GetInputTransferPaths()
+	}
+	gjson.Parse(input).ForEach(func(key, value gjson.Result) bool {
+		if strings.HasPrefix(key.String(), RESERVED_KEY_PREFIX) {
+			return true // 避免输入覆盖仓库、上下文、请求头等内部数据
+		}
+		if schema != nil {
+			if property, ok := schema.Properties[key.String()]; ok && property.Dst != "" {
+				return true
+			}
+		}
+		volume.SetValue(key.String(), value.Value())
+		return true
+	})
+	for _, tp := range transferPaths {
+		result := gjson.Get(input, tp.Src)
+		if !result.Exists() {
+			continue
+		}
+		volume.SetValue(tp.Dst, result.Value())
+	}
+}
+
+func (r *repository) initVolume(volume VolumeInterface) (VolumeInterface, error) {
 	if volume == nil {
 		volume = &volumeMap{}
 	} else {
 		volumeR := reflect.ValueOf(volume)
 		if volumeR.IsNil() {
 			err := errors.Errorf("%#v must not nil", volumeR)
-			return "", err
+			return nil, err
+		}
+	}
+	var tmp RepositoryInterface
+	if !volume.GetValue(REPOSITORY_KEY, &tmp) {
+		volume.SetValue(REPOSITORY_KEY, r) // 模板内调用 execSQLTpl 等函数需要从容器获取仓库
+	}
+	return volume, nil
+}
+
+// executeTemplate 执行模板，执行过程中的错误及 panic 统一转换为 *ExecuteError，出错时回滚本次执行中开启的事务
+func (r *repository) executeTemplate(ctx context.Context, name string, volume VolumeInterface) (out string, err error) {
+	var parentCleanup *executionCleanup
+	volume.GetValue(CLEANUP_KEY, &parentCleanup)
+	cleanup := &executionCleanup{}
+	volume.SetValue(CLEANUP_KEY, cleanup)
+	defer func() {
+		cleanup.run() // 释放本次执行中未读完的流式查询等资源
+		volume.SetValue(CLEANUP_KEY, parentCleanup)
+	}()
+	defer func() {
+		if panicInfo := recover(); panicInfo != nil {
+			out, err = "", newExecuteError(name, recoverError(panicInfo))
+		}
+		if err != nil {
+			rollbackTx(ctx, volume)
+			return
+		}
+		// 顶层执行结束时仍未提交的事务回滚并返回错误，避免事务及其连接泄漏
+		if parentCleanup == nil && rollbackTx(ctx, volume) {
+			out, err = "", newExecuteError(name, errors.Errorf("transaction not committed, rolled back"))
 		}
+	}()
+	if err := ctx.Err(); err != nil {
+		return "", newExecuteError(name, errors.WithStack(err))
 	}
 	var b bytes.Buffer
-	err := r.template.ExecuteTemplate(&b, name, volume)
+	err = r.template.ExecuteTemplate(&b, name, volume)
 	if err != nil {
-		err = errors.WithStack(err)
-		return "", err
+		return "", newExecuteError(name, err)
 	}
-	out := strings.ReplaceAll(b.String(), provider.WINDOW_EOF, provider.EOF)
+	out = strings.ReplaceAll(b.String(), provider.WINDOW_EOF, provider.EOF)
 	out = util.TrimSpaces(out)
 	return out, nil
 }
 
+// executionCleanup 单次模板执行结束时需要释放的资源，executeTemplate 结束时按注册的逆序执行
+type executionCleanup struct {
+	lock  sync.Mutex
+	funcs []func()
+}
+
+// add 注册清理函数，c 为 nil(不在 executeTemplate 中执行)时返回 false
+func (c *executionCleanup) add(f func()) bool {
+	if c == nil {
+		return false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.funcs = append(c.funcs, f)
+	return true
+}
+
+func (c *executionCleanup) run() {
+	c.lock.Lock()
+	funcs := c.funcs
+	c.funcs = nil
+	c.lock.Unlock()
+	for i := len(funcs) - 1; i >= 0; i-- {
+		funcs[i]()
+	}
+}
+
+// rollbackTx 回滚模板执行期间开启且未结束的事务，并恢复容器上下文，存在这样的事务时返回 true
+func rollbackTx(entryCtx context.Context, volume VolumeInterface) bool {
+	entryTxManager, _ := provider.TxManagerFromContext(entryCtx)
+	ctx := getContextFromVolume(volume)
+	txManager, ok := provider.TxManagerFromContext(ctx)
+	if !ok || txManager == entryTxManager {
+		return false
+	}
+	for ok && txManager != entryTxManager {
+		txManager.Rollback() // 已提交或已回滚的事务返回错误，忽略
+		ctx = txManager.Parent()
+		txManager, ok = provider.TxManagerFromContext(ctx)
+	}
+	volume.SetValue(CONTEXT_KEY, ctx)
+	return true
+}
+
 func (r *repository) TemplateExists(name string) bool {
 	t := r.template.Lookup(name)
 	return t != nil
@@ -1,10 +1,19 @@
 package templatemap
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/suifengpiao14/templatemap/provider"
+	"github.com/suifengpiao14/templatemap/util"
 )
 
 func TestRepository(t *testing.T) {
@@ -37,3 +46,259 @@ func TestConvertType(t *testing.T) {
 	fmt.Println(ok)
 	fmt.Println(dst)
 }
+
+func TestExecuteTemplateContext(t *testing.T) {
+	r := NewRepository()
+	r.AddTemplateByStr("sleep", `sleep 5`)
+	r.AddTemplateByStr("main", `{{execBinTpl . "sleep"}}`)
+	r.RegisterMeta("sleep", &TemplateMeta{Name: "sleep", ExecProvider: &provider.BinExecProvider{}})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := r.ExecuteTemplateContext(ctx, "main", NewVolume(r))
+	if err == nil {
+		t.Fatal("expected error when context deadline exceeded")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("command not canceled with context, took %s", time.Since(start))
+	}
+}
+
+func TestExecuteTemplateError(t *testing.T) {
+	r := NewRepository()
+	r.AddTemplateByStr("inner", `{{getSetValueNumberWithOutEmptyStr . "Limit" "PageSize"}}`)
+	r.AddTemplateByStr("outer", `{{executeTemplate . "inner"}}`)
+	_, err := r.ExecuteTemplate("outer", NewVolume(r))
+	var executeError *ExecuteError
+	if !errors.As(err, &executeError) {
+		t.Fatalf("expected *ExecuteError, got %#v", err)
+	}
+	if got := strings.Join(executeError.TplStack, "->"); got != "outer->inner" {
+		t.Errorf("TplStack got %s", got)
+	}
+	if executeError.FuncName != "getSetValueNumberWithOutEmptyStr" {
+		t.Errorf("FuncName got %s", executeError.FuncName)
+	}
+	if !strings.Contains(errors.Cause(err).Error(), "key(PageSize) required number format") {
+		t.Errorf("cause got %v", errors.Cause(err))
+	}
+}
+
+func TestBusinessError(t *testing.T) {
+	r := NewRepository()
+	r.AddTemplateByStr("checkUser", `{{panic 404 "10001" "user not found" "{\"userId\":1}"}}`)
+	r.AddTemplateByStr("getUser", `{{executeTemplate . "checkUser"}}`)
+	_, err := r.ExecuteTemplate("getUser", NewVolume(r))
+	var businessError *BusinessError
+	if !errors.As(err, &businessError) {
+		t.Fatalf("expected *BusinessError, got %#v", err)
+	}
+	if businessError.HttpCode != 404 || businessError.BusinessCode != "10001" || businessError.TplName != "checkUser" {
+		t.Errorf("got %#v", businessError)
+	}
+	httpStatus, body := ErrorResponse(err)
+	want := `{"code":"10001","message":"user not found","data":{"userId":1}}`
+	if httpStatus != 404 || string(body) != want {
+		t.Errorf("got %d %s, want 404 %s", httpStatus, body, want)
+	}
+}
+
+// parallelTestProvider 记录同时执行的数量，达到 limit 前阻塞，确保并发执行
+type parallelTestProvider struct {
+	limit       int
+	lock        sync.Mutex
+	inFlight    int
+	maxInFlight int
+	reached     chan struct{}
+	reachedOnce sync.Once
+}
+
+func (p *parallelTestProvider) Exec(identifier string, s string) (string, error) {
+	p.lock.Lock()
+	p.inFlight++
+	if p.inFlight > p.maxInFlight {
+		p.maxInFlight = p.inFlight
+	}
+	if p.inFlight == p.limit {
+		p.reachedOnce.Do(func() { close(p.reached) })
+	}
+	p.lock.Unlock()
+	defer func() {
+		p.lock.Lock()
+		p.inFlight--
+		p.lock.Unlock()
+	}()
+	select {
+	case <-p.reached:
+	case <-time.After(5 * time.Second): // 仅防止未并发执行时阻塞
+		return "", errors.Errorf("%s: concurrency never reached %d", identifier, p.limit)
+	}
+	if s == "fail" {
+		return "", errors.Errorf("%s failed", identifier)
+	}
+	return s, nil
+}
+
+func (p *parallelTestProvider) GetSource() interface{} {
+	return nil
+}
+
+func TestExecParallel(t *testing.T) {
+	r := NewRepository(WithParallelLimit(2))
+	execProvider := &parallelTestProvider{limit: 2, reached: make(chan struct{})}
+	for _, name := range []string{"a", "b", "c", "d", "e", "fail"} {
+		r.AddTemplateByStr(name, name)
+		r.RegisterMeta(name, &TemplateMeta{Name: name, ExecProvider: execProvider})
+	}
+	r.AddTemplateByStr("main", `{{execParallel . "a" "b" "c" "d" "e"}}`)
+	r.AddTemplateByStr("mainFail", `{{execParallel . "a" "fail"}}`)
+
+	volume := NewSyncVolume(r)
+	_, err := r.ExecuteTemplate("main", volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if execProvider.maxInFlight != 2 {
+		t.Errorf("execParallel with limit 2 got max %d in flight", execProvider.maxInFlight)
+	}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		var out string
+		volume.GetValue(name+"Out", &out)
+		if out != name {
+			t.Errorf("%sOut got %q", name, out)
+		}
+	}
+
+	_, err = r.ExecuteTemplate("mainFail", NewSyncVolume(r))
+	var parallelError *ParallelError
+	if !errors.As(err, &parallelError) || len(parallelError.Errors) != 1 || parallelError.TplNames[0] != "fail" {
+		t.Errorf("expected ParallelError for fail, got %v", err)
+	}
+
+	plainVolume := NewVolume(r)
+	if _, err = r.ExecuteTemplate("main", plainVolume); err != nil {
+		t.Errorf("plain volume got %v", err)
+	}
+	var aOut string
+	if plainVolume.GetValue("aOut", &aOut); aOut != "a" {
+		t.Errorf("plain volume aOut got %q", aOut)
+	}
+}
+
+func TestInvoke(t *testing.T) {
+	r := NewRepository()
+	r.AddTemplateByStr("getUser", `{{getSetValue . "UserID" "ID"}}{{setValue . "UserName" (printf "%s-%v" .keyword .PageSize)}}`)
+	inputMeta, err := NewLineschemaMeta(`
+	version=http://json-schema.org/draft-07/schema#,id=getUserIn,direction=in
+	fullname=id,type=integer,required,dst=ID
+	fullname=keyword,type=string
+	fullname=pageSize,type=integer,default=20,dst=PageSize
+	`)
+	if err != nil {
+		panic(err)
+	}
+	outputMeta, err := NewLineschemaMeta(`
+	version=http://json-schema.org/draft-07/schema#,id=getUserOut,direction=out
+	fullname=id,type=integer,src=UserID
+	fullname=name,type=string,src=UserName
+	fullname=pagination.pageSize,type=integer,src=PageSize
+	`)
+	if err != nil {
+		panic(err)
+	}
+	r.RegisterMeta("getUser", &TemplateMeta{Name: "getUser", LineschemaMeta: inputMeta, OutputLineschemaMeta: outputMeta})
+
+	out, err := r.Invoke("getUser", `{"id":1,"keyword":"abc"}`)
+	if err != nil {
+		panic(err)
+	}
+	var got, want interface{}
+	json.Unmarshal([]byte(out), &got)
+	json.Unmarshal([]byte(`{"id":1,"name":"abc-20","pagination":{"pageSize":20}}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %s, want %v", out, want)
+	}
+
+	for _, input := range []string{`{"keyword":"abc"}`, `{"id":"1"}`, `{"id":`} {
+		_, err = r.Invoke("getUser", input)
+		var validateError *util.ValidateError
+		if !errors.As(err, &validateError) {
+			t.Errorf("%s expected *util.ValidateError, got %v", input, err)
+			continue
+		}
+		fmt.Println(validateError.Errors)
+		if httpStatus, _ := ErrorResponse(err); httpStatus != 400 {
+			t.Errorf("%s got http status %d, want 400", input, httpStatus)
+		}
+	}
+}
+
+func TestInvokeExecParallel(t *testing.T) {
+	r := NewRepository()
+	execProvider := &parallelTestProvider{limit: 2, reached: make(chan struct{})}
+	for _, name := range []string{"a", "b"} {
+		r.AddTemplateByStr(name, name)
+		r.RegisterMeta(name, &TemplateMeta{Name: name, ExecProvider: execProvider})
+	}
+	r.AddTemplateByStr("api", `{{execParallel . "a" "b"}}{{.aOut}}{{.bOut}}`)
+	out, err := r.Invoke("api", `{}`)
+	if err != nil {
+		panic(err)
+	}
+	if out != "ab" {
+		t.Errorf("got %s, want ab", out)
+	}
+}
+
+func TestInvokeReservedKeys(t *testing.T) {
+	r := NewRepository()
+	r.AddTemplateByStr("api", `{{getValue . "__header.X-Admin"}}|{{getValue . "__inIndex"}}|{{.name}}`)
+	out, err := r.Invoke("api", `{"__repository":"x","__context":"x","__header":{"X-Admin":"1"},"__inIndex":9,"name":"a"}`)
+	if err != nil {
+		panic(err)
+	}
+	if want := "<no value>|<no value>|a"; out != want {
+		t.Errorf("reserved input keys got %s, want %s", out, want)
+	}
+	ctx := ContextWithHeader(context.Background(), map[string]string{"X-Admin": "0"})
+	out, err = r.InvokeContext(ctx, "api", `{"__header":{"X-Admin":"1"},"name":"b"}`)
+	if err != nil {
+		panic(err)
+	}
+	if want := "0|<no value>|b"; out != want {
+		t.Errorf("context header got %s, want %s", out, want)
+	}
+}
+
+func TestCaptureProvider(t *testing.T) {
+	capture := provider.NewCaptureExecProvider(map[string]string{
+		"getUser": `[{"id":"1","name":"张三"}]`,
+	})
+	r := NewRepository(WithCaptureProvider(capture))
+	r.AddTemplateByStr("getUser", "select * from `user` where `id`=:ID")
+	r.AddTemplateByStr("notify", "POST http://127.0.0.1:1/notify HTTP/1.1\nContent-Type: application/json\n\n{\"id\":{{.ID}}}")
+	r.AddTemplateByStr("main", `{{execSQLTpl . "getUser"}}{{execCURLTpl . "notify"}}{{getValue . "getUserOut"}}`)
+	dbMeta := &TemplateMeta{Name: "getUser", ExecProvider: &provider.DBExecProvider{}}
+	r.RegisterMeta("getUser", dbMeta)
+	r.RegisterMeta("notify", &TemplateMeta{Name: "notify", ExecProvider: &provider.CURLExecProvider{}})
+	if _, ok := dbMeta.ExecProvider.(*provider.DBExecProvider); !ok {
+		t.Errorf("registered meta modified: %#v", dbMeta)
+	}
+
+	volume := NewVolume(r)
+	volume.SetValue("ID", 1)
+	out, err := r.ExecuteTemplate("main", volume)
+	if err != nil {
+		panic(err)
+	}
+	if want := `[{"id":"1","name":"张三"}]`; out != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+	var sql string
+	volume.GetValue("getUserSQL", &sql)
+	records := capture.Records()
+	fmt.Println(records)
+	if len(records) != 2 || records[0].Identifier != "getUser" || records[0].Input != sql || records[1].Identifier != "notify" {
+		t.Errorf("got records %#v, getUserSQL %s", records, sql)
+	}
+}
@@ -0,0 +1,62 @@
+package templatemap
+
+import (
+	"sync"
+)
+
+// SyncVolumeInterface 并发安全容器
+// 约定:
+//  1. 所有读写必须通过 GetValue/SetValue 完成，模板内使用 getValue 读取，不支持 .Key 直接访问(模板数据为结构体，直接访问会返回执行错误而不是产生数据竞争)
+//  2. 多级 key(如 a.b、a.c)的读-改-写在同一把锁内完成，并发写入同一根节点不会丢失更新
+//  3. 计数器(如 in 函数使用的 __inIndex)必须通过 Incr 原子自增
+type SyncVolumeInterface interface {
+	VolumeInterface
+	Incr(key string, delta int) (value int)
+}
+
+func NewSyncVolume(r RepositoryInterface) SyncVolumeInterface {
+	return &syncVolume{
+		data: volumeMap{
+			REPOSITORY_KEY: r,
+		},
+	}
+}
+
+type syncVolume struct {
+	lock sync.RWMutex
+	data volumeMap
+}
+
+func (v *syncVolume) SetValue(key string, value interface{}) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.data.SetValue(key, value)
+}
+
+func (v *syncVolume) GetValue(key string, value interface{}) bool {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.data.GetValue(key, value)
+}
+
+// Incr 原子自增，返回自增后的值
+func (v *syncVolume) Incr(key string, delta int) int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	var value int
+	v.data.GetValue(key, &value)
+	value += delta
+	v.data.SetValue(key, value)
+	return value
+}
+
+// snapshot 浅拷贝当前数据，供 toSQL 等需要整体读取的场景使用
+func (v *syncVolume) snapshot() map[string]interface{} {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	out := make(map[string]interface{}, len(v.data))
+	for k, val := range v.data {
+		out[k] = val
+	}
+	return out
+}
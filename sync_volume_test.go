@@ -0,0 +1,115 @@
+package templatemap
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const syncVolumeWorkers = 50
+
+func TestSyncVolumeSetGetValue(t *testing.T) {
+	volume := NewSyncVolume(NewRepository())
+	var wg sync.WaitGroup
+	for i := 0; i < syncVolumeWorkers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key%d", i)
+			volume.SetValue(key, i)
+			var v int
+			if !volume.GetValue(key, &v) || v != i {
+				t.Errorf("%s got %d, want %d", key, v, i)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSyncVolumeNestedKey(t *testing.T) {
+	volume := NewSyncVolume(NewRepository())
+	var wg sync.WaitGroup
+	for i := 0; i < syncVolumeWorkers; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			volume.SetValue(fmt.Sprintf("a.b%d", i), i)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			volume.SetValue(fmt.Sprintf("a.c%d", i), i)
+			var v interface{}
+			volume.GetValue("a", &v)
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < syncVolumeWorkers; i++ {
+		for _, prefix := range []string{"a.b", "a.c"} {
+			key := fmt.Sprintf("%s%d", prefix, i)
+			var v int
+			if !volume.GetValue(key, &v) || v != i {
+				t.Errorf("lost update %s got %d, want %d", key, v, i)
+			}
+		}
+	}
+}
+
+func TestSyncVolumeIn(t *testing.T) {
+	volume := NewSyncVolume(NewRepository())
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	placeholders := make(map[string]bool)
+	for i := 0; i < syncVolumeWorkers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			str, err := In(volume, []int{i, i})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			for _, placeholder := range strings.Split(str, ",") {
+				if placeholders[placeholder] {
+					t.Errorf("duplicate placeholder %s", placeholder)
+				}
+				placeholders[placeholder] = true
+			}
+		}(i)
+	}
+	wg.Wait()
+	var inIndex int
+	volume.GetValue(IN_INDEX, &inIndex)
+	if inIndex != syncVolumeWorkers*2 || len(placeholders) != syncVolumeWorkers*2 {
+		t.Errorf("%s got %d, placeholders %d, want %d", IN_INDEX, inIndex, len(placeholders), syncVolumeWorkers*2)
+	}
+}
+
+func TestSyncVolumeExecuteTemplate(t *testing.T) {
+	r := NewRepository()
+	r.AddTemplateByStr("incr", `{{setValue . (printf "out.%v" (getValue . "id")) (getValue . "id")}}`)
+	r.AddTemplateByStr("direct", `{{.id}}`)
+	volume := NewSyncVolume(r)
+	volume.SetValue("id", 1)
+	var wg sync.WaitGroup
+	for i := 0; i < syncVolumeWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.ExecuteTemplate("incr", volume)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	var out int
+	if !volume.GetValue("out.1", &out) || out != 1 {
+		t.Errorf("out.1 got %d", out)
+	}
+	if _, err := r.ExecuteTemplate("direct", volume); err == nil {
+		t.Error("expected error when reading sync volume by .Key")
+	}
+}
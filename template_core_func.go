@@ -1,11 +1,14 @@
 package templatemap
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/jmoiron/sqlx"
@@ -14,7 +17,6 @@ import (
 	"github.com/suifengpiao14/templatemap/util"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
-	gormLogger "gorm.io/gorm/logger"
 )
 
 var CoreFuncMap = template.FuncMap{
@@ -33,7 +35,13 @@ var CoreFuncMap = template.FuncMap{
 	"exec":                             Exec,
 	"execBinTpl":                       ExecBinTpl,
 	"execSQLTpl":                       ExecSQLTpl,
+	"execSQLStream":                    ExecSQLStream,
 	"execCURLTpl":                      ExecCURLTpl,
+	"execParallel":                     ExecParallel,
+	"beginTx":                          BeginTx,
+	"commit":                           Commit,
+	"rollback":                         Rollback,
+	"transaction":                      Transaction,
 	"gjsonGet":                         gjson.Get,
 	"sjsonSet":                         sjson.Set,
 	"sjsonSetRaw":                      sjson.SetRaw,
@@ -46,24 +54,33 @@ var CoreFuncMap = template.FuncMap{
 	"listPadIndex":                     ListPadIndex, //生成指定长度的整型数组，变相在模板中实现for
 }
 
-func getRepositoryFromVolume(volume VolumeInterface) RepositoryInterface {
+func getRepositoryFromVolume(volume VolumeInterface) (RepositoryInterface, error) {
 	var r RepositoryInterface
 	ok := volume.GetValue(REPOSITORY_KEY, &r)
 	if !ok {
 		err := errors.Errorf("not found repository  key %s in %#v", REPOSITORY_KEY, volume)
-		panic(err)
+		return nil, err
 	}
-	return r
+	return r, nil
 }
 
-// ExecuteTemplate 模板中调用模板
-func ExecuteTemplate(volume VolumeInterface, name string) string {
-	var r = getRepositoryFromVolume(volume)
-	out, err := r.ExecuteTemplate(name, volume)
+// getContextFromVolume 获取容器中的上下文，未设置时返回 context.Background()
+func getContextFromVolume(volume VolumeInterface) context.Context {
+	var ctx context.Context
+	ok := volume.GetValue(CONTEXT_KEY, &ctx)
+	if !ok || ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// ExecuteTemplate 模板中调用模板，返回的 error 会中断外层模板执行，嵌套的调用栈由仓库合并到 ExecuteError
+func ExecuteTemplate(volume VolumeInterface, name string) (string, error) {
+	r, err := getRepositoryFromVolume(volume)
 	if err != nil {
-		panic(err) // ExecuteTemplate 函数可能嵌套很多层，抛出错误值后有可能被当成正常值处理，所以此处直接panic 退出，保留原始错误输出
+		return "", err
 	}
-	return out
+	return r.ExecuteTemplate(name, volume)
 }
 
 func SetValue(volume VolumeInterface, key string, value interface{}) string { // SetValue 返回空字符，不对模板产生新输出
@@ -96,9 +113,20 @@ func DBValidate(volume VolumeInterface, ok bool, msg string) string {
 	return value
 }
 
-func Panic(httpCode string, businessCode string, msg string) string {
-	err := errors.Errorf("%s#%s#%s", httpCode, businessCode, msg)
-	panic(err)
+// Panic 中断模板执行并返回 *BusinessError，data 为可选的附加数据(json 字符串按原样输出)
+func Panic(httpCode interface{}, businessCode string, msg string, data ...interface{}) (string, error) {
+	err := NewBusinessError(httpCode, businessCode, msg)
+	switch len(data) {
+	case 0:
+	case 1:
+		err.Data = data[0]
+		if str, ok := data[0].(string); ok && gjson.Valid(str) {
+			err.Data = json.RawMessage(str)
+		}
+	default:
+		err.Data = data
+	}
+	return "", err
 }
 
 func GetValue(volume VolumeInterface, key string) interface{} {
@@ -119,53 +147,53 @@ func GetSetValueInt(volume VolumeInterface, setKey string, getKey string) string
 	return ""
 }
 
-func GetSetValueNumberWithOutEmptyStr(volume VolumeInterface, setKey string, getKey string) string {
+func GetSetValueNumberWithOutEmptyStr(volume VolumeInterface, setKey string, getKey string) (string, error) {
 	var v string
 	volume.GetValue(getKey, &v)
 	v = strings.TrimSpace(v)
 	if v == "" {
 		err := errors.Errorf("key(%s) required number format,got empty", getKey)
-		panic(err)
+		return "", err
 	}
 	if strings.Contains(v, ".") {
 		oFloat, err := strconv.ParseFloat(v, 64)
 		if err != nil {
 			err = errors.WithStack(err)
-			panic(err)
+			return "", err
 		}
 		volume.SetValue(setKey, oFloat)
-		return ""
+		return "", nil
 	}
 	oInt, err := strconv.Atoi(v)
 	if err != nil {
 		err = errors.WithStack(err)
-		panic(err)
+		return "", err
 	}
 	volume.SetValue(setKey, oInt)
-	return ""
+	return "", nil
 }
 
-func GetSetValueNumber(volume VolumeInterface, setKey string, getKey string) string {
+func GetSetValueNumber(volume VolumeInterface, setKey string, getKey string) (string, error) {
 	var v string
 	volume.GetValue(getKey, &v)
 	if v == "" {
 		volume.SetValue(setKey, 0)
-		return ""
+		return "", nil
 	}
 	return GetSetValueNumberWithOutEmptyStr(volume, setKey, getKey)
 }
 
-func GetSetColumn2Row(volume VolumeInterface, key string) string {
+func GetSetColumn2Row(volume VolumeInterface, key string) (string, error) {
 	var v interface{}
 	volume.GetValue(key, &v) // 多级key,返回的为map类型,无法转换为string
 	if v == nil {
-		return ""
+		return "", nil
 	}
 	str, ok := v.(string) //OK=true 表示去处的是字符串json,后续设置时,也设置字符串,否则,表示取出map[string][]interface{}格式,后续设置的时候也需要设置[]map[string]interface{}格式
 	if !ok {
 		b, err := json.Marshal(v)
 		if err != nil {
-			panic(err)
+			return "", err
 		}
 		str = string(b)
 	}
@@ -176,24 +204,24 @@ func GetSetColumn2Row(volume VolumeInterface, key string) string {
 		arr := make([]map[string]interface{}, 0)
 		err := json.Unmarshal([]byte(out), &arr)
 		if err != nil {
-			panic(err)
+			return "", err
 		}
 		newVal = arr
 	}
 	volume.SetValue(key, newVal)
-	return ""
+	return "", nil
 }
-func GetSetRow2Column(volume VolumeInterface, key string) string {
+func GetSetRow2Column(volume VolumeInterface, key string) (string, error) {
 	var v interface{}
 	volume.GetValue(key, &v) // 多级key,返回的为map类型,无法转换为string
 	if v == nil {
-		return ""
+		return "", nil
 	}
 	str, ok := v.(string) //OK=true 表示去处的是字符串json,后续设置时,也设置字符串,否则,表示取出map[string][]interface{}格式,后续设置的时候也需要设置[]map[string]interface{}格式
 	if !ok {
 		b, err := json.Marshal(v)
 		if err != nil {
-			panic(err)
+			return "", err
 		}
 		str = string(b)
 	}
@@ -204,54 +232,70 @@ func GetSetRow2Column(volume VolumeInterface, key string) string {
 		arr := make([]map[string]interface{}, 0)
 		err := json.Unmarshal([]byte(out), &arr)
 		if err != nil {
-			panic(err)
+			return "", err
 		}
 		newVal = arr
 	}
 	volume.SetValue(key, newVal)
-	return ""
+	return "", nil
 }
-func GetSource(volume VolumeInterface, tplName string) (source interface{}) {
-	provider := GetProvider(volume, tplName)
-	return provider.GetSource()
+func GetSource(volume VolumeInterface, tplName string) (source interface{}, err error) {
+	provider, err := GetProvider(volume, tplName)
+	if err != nil {
+		return nil, err
+	}
+	return provider.GetSource(), nil
 }
-func GetProvider(volume VolumeInterface, tplName string) provider.ExecproviderInterface {
-	var r = getRepositoryFromVolume(volume)
+func GetProvider(volume VolumeInterface, tplName string) (provider.ExecproviderInterface, error) {
+	r, err := getRepositoryFromVolume(volume)
+	if err != nil {
+		return nil, err
+	}
 	meta, ok := r.GetMeta(tplName)
 	if !ok {
 		err := errors.Errorf("templatemap.Exec: not found meta  by template name : %s", tplName)
-		panic(err)
+		return nil, err
 	}
 
 	execProvider := meta.ExecProvider
 	if execProvider == nil {
 		err := errors.Errorf("meta:%v provider must be set", meta)
-		panic(err)
+		return nil, err
 	}
-	return execProvider
+	return execProvider, nil
 }
 
-func Exec(volume VolumeInterface, tplName string, s string) string {
-	provider := GetProvider(volume, tplName)
-	out, err := provider.Exec(tplName, s)
+func Exec(volume VolumeInterface, tplName string, s string) (string, error) {
+	execProvider, err := GetProvider(volume, tplName)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	return out
+	ctx := getContextFromVolume(volume)
+	return provider.ExecWithContext(ctx, execProvider, tplName, s)
 }
 
+// ToSQL 将参数值拼接到 SQL 中(按 mysql 方言转义)，结果仅用于日志及调试，执行时使用 ToNamedSQL 返回的语句和参数
 func ToSQL(volume VolumeInterface, namedSQL string) (string, error) {
-	data, err := getNamedData(volume)
+	statment, arguments, err := ToNamedSQL(volume, namedSQL)
 	if err != nil {
 		return "", err
 	}
-	statment, arguments, err := sqlx.Named(namedSQL, data)
+	sql := provider.DialectOf(nil).ExplainSQL(statment, arguments...)
+	return sql, nil
+}
+
+// ToNamedSQL 将 :name 命名参数 SQL 转换为 ? 占位符语句及对应参数
+func ToNamedSQL(volume VolumeInterface, namedSQL string) (statment string, arguments []interface{}, err error) {
+	data, err := getNamedData(volume)
+	if err != nil {
+		return "", nil, err
+	}
+	statment, arguments, err = sqlx.Named(namedSQL, data)
 	if err != nil {
 		err = errors.WithStack(err)
-		return "", err
+		return "", nil, err
 	}
-	sql := gormLogger.ExplainSQL(statment, nil, `'`, arguments...)
-	return sql, nil
+	return statment, arguments, nil
 }
 
 func getNamedData(data interface{}) (out map[string]interface{}, err error) {
@@ -281,6 +325,10 @@ func getNamedData(data interface{}) (out map[string]interface{}, err error) {
 		out = *mapOutRef
 		return
 	}
+	if syncVolume, ok := data.(*syncVolume); ok {
+		out = syncVolume.snapshot()
+		return
+	}
 
 	v := reflect.Indirect(reflect.ValueOf(data))
 
@@ -326,43 +374,281 @@ func getNamedData(data interface{}) (out map[string]interface{}, err error) {
 	return
 }
 
-func ExecCURLTpl(volume VolumeInterface, templateName string) error {
-	tplOut := ExecuteTemplate(volume, templateName)
-	out := Exec(volume, templateName, tplOut)
+// ExecCURLTpl 执行 http 模板，响应存储在 <name>Out，状态码非成功时同样存储响应并返回 *provider.HTTPStatusError(模板执行中止)；
+// 需要在模板中按 httpStatus 分支处理时，在 http 模板中设置 x-http-success-status 请求头(如 2xx,404 或 *)将对应状态码视为成功
+func ExecCURLTpl(volume VolumeInterface, templateName string) (string, error) {
+	tplOut, err := ExecuteTemplate(volume, templateName)
+	if err != nil {
+		return "", err
+	}
+	out, err := Exec(volume, templateName, tplOut)
 	storeKey := fmt.Sprintf("%sOut", templateName)
+	if err != nil {
+		var statusError *provider.HTTPStatusError
+		if errors.As(err, &statusError) {
+			volume.SetValue(storeKey, out)
+		}
+		return "", err
+	}
 	volume.SetValue(storeKey, out)
-	return nil
+	return "", nil
 }
 
-func ExecBinTpl(volume VolumeInterface, templateName string) error {
-	tplOut := ExecuteTemplate(volume, templateName)
-	out := Exec(volume, templateName, tplOut)
+func ExecBinTpl(volume VolumeInterface, templateName string) (string, error) {
+	tplOut, err := ExecuteTemplate(volume, templateName)
+	if err != nil {
+		return "", err
+	}
+	out, err := Exec(volume, templateName, tplOut)
+	if err != nil {
+		return "", err
+	}
 	storeKey := fmt.Sprintf("%sOut", templateName)
 	volume.SetValue(storeKey, out)
-	return nil
+	return "", nil
 }
 
-func ExecSQLTpl(volume VolumeInterface, templateName string) string {
+func ExecSQLTpl(volume VolumeInterface, templateName string) (string, error) {
 	//{{executeTemplate . "Paginate"|toSQL . | exec . "docapi_db2"|setValue . }}
-	tplOut := ExecuteTemplate(volume, templateName)
-	tplOut = util.StandardizeSpaces(tplOut)
+	execProvider, statment, arguments, err := renderSQLTpl(volume, templateName)
+	if err != nil {
+		return "", err
+	}
+	var out string
+	if sqlProvider, ok := execProvider.(provider.SQLExecproviderInterface); ok {
+		ctx := getContextFromVolume(volume)
+		out, err = sqlProvider.ExecSQL(ctx, templateName, statment, arguments...)
+	} else {
+		sql := provider.DialectOf(execProvider).ExplainSQL(statment, arguments...)
+		out, err = Exec(volume, templateName, sql)
+	}
+	if err != nil {
+		return "", err
+	}
+	storeKey := fmt.Sprintf("%sOut", templateName)
+	volume.SetValue(storeKey, out)
+	return "", nil // 符合模板函数，至少一个输出结构
+}
+
+// renderSQLTpl 执行 SQL 模板，返回执行器、语句及参数，拼接参数后的 SQL 存储在 <name>SQL
+func renderSQLTpl(volume VolumeInterface, templateName string) (provider.ExecproviderInterface, string, []interface{}, error) {
+	tplOut, err := ExecuteTemplate(volume, templateName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	execProvider, err := GetProvider(volume, templateName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	dialect := provider.DialectOf(execProvider)
+	tplOut = util.StandardizeSpaces(dialect.StripComments(tplOut)) // 合并空白前删除注释，避免行注释吞掉后续语句
 	if tplOut == "" {
 		err := errors.Errorf("sql template :%s return empty sql", templateName)
-		panic(err)
+		return nil, "", nil, err
 	}
-	sql, err := ToSQL(volume, tplOut)
+	statment, arguments, err := ToNamedSQL(volume, tplOut)
 	if err != nil {
-		panic(err)
+		return nil, "", nil, err
 	}
+	sql := dialect.ExplainSQL(statment, arguments...)
 	sqlKey := fmt.Sprintf("%sSQL", templateName)
-	volume.SetValue(sqlKey, sql)
-	out := Exec(volume, templateName, sql)
+	volume.SetValue(sqlKey, sql) // 拼接参数后的 SQL 仅用于日志
+	return execProvider, statment, arguments, nil
+}
+
+// SQLStreamBatch execSQLStream 输出的一批记录，读取出错时最后一批的 Err 不为空
+type SQLStreamBatch struct {
+	Rows []map[string]interface{}
+	Err  error
+}
+
+// querySQLTpl 执行 SQL 模板并流式查询，执行器需实现 provider.SQLStreamExecproviderInterface
+func querySQLTpl(ctx context.Context, volume VolumeInterface, templateName string) (*provider.SQLRows, error) {
+	execProvider, statment, arguments, err := renderSQLTpl(volume, templateName)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	storeKey := fmt.Sprintf("%sOut", templateName)
-	volume.SetValue(storeKey, out)
-	return "" // 符合模板函数，至少一个输出结构
+	streamProvider, ok := execProvider.(provider.SQLStreamExecproviderInterface)
+	if !ok {
+		err = errors.Errorf("sql template %s provider %T not support stream", templateName, execProvider)
+		return nil, err
+	}
+	return streamProvider.QuerySQL(ctx, templateName, statment, arguments...)
+}
+
+// ExecSQLStream 流式执行查询模板，按批次(默认 SQL_STREAM_BATCH_SIZE 行)输出，结果不存储在容器中，如:
+// {{range $batch := execSQLStream . "Export" 500}}{{if $batch.Err}}...{{end}}{{range $batch.Rows}}...{{end}}{{end}}
+// range 提前中断(出错、panic、break)时，查询在外层模板执行结束后取消并释放连接；不在模板中调用时需读完全部批次或结束容器中的 ctx
+func ExecSQLStream(volume VolumeInterface, templateName string, batchSize ...int) (<-chan SQLStreamBatch, error) {
+	ctx, cancel := context.WithCancel(getContextFromVolume(volume))
+	var cleanup *executionCleanup
+	volume.GetValue(CLEANUP_KEY, &cleanup)
+	cleanup.add(cancel)
+	rows, err := querySQLTpl(ctx, volume, templateName)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	size := SQL_STREAM_BATCH_SIZE
+	if len(batchSize) > 0 && batchSize[0] > 0 {
+		size = batchSize[0]
+	}
+	ch := make(chan SQLStreamBatch)
+	go func() {
+		defer close(ch)
+		defer cancel()
+		defer rows.Close()
+		batch := SQLStreamBatch{Rows: make([]map[string]interface{}, 0, size)}
+		send := func() bool {
+			select {
+			case ch <- batch:
+				batch = SQLStreamBatch{Rows: make([]map[string]interface{}, 0, size)}
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for rows.Next() {
+			batch.Rows = append(batch.Rows, rows.Record())
+			if len(batch.Rows) == size && !send() {
+				return
+			}
+		}
+		batch.Err = rows.Err()
+		if len(batch.Rows) > 0 || batch.Err != nil {
+			send()
+		}
+	}()
+	return ch, nil
+}
+
+// StreamSQLTpl 流式执行查询模板，结果按 format(provider.STREAM_FORMAT_NDJSON、provider.STREAM_FORMAT_CSV) 写入 w，返回写入的行数
+func StreamSQLTpl(volume VolumeInterface, templateName string, w io.Writer, format string) (int, error) {
+	rows, err := querySQLTpl(getContextFromVolume(volume), volume, templateName)
+	if err != nil {
+		return 0, err
+	}
+	return provider.WriteRows(w, rows, format)
+}
+
+// execTplByProvider 根据模板执行器类型选择 execSQLTpl 或 execCURLTpl(execBinTpl 逻辑相同)
+func execTplByProvider(volume VolumeInterface, templateName string) (string, error) {
+	execProvider, err := GetProvider(volume, templateName)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := execProvider.(provider.SQLExecproviderInterface); ok {
+		return ExecSQLTpl(volume, templateName)
+	}
+	return ExecCURLTpl(volume, templateName)
+}
+
+// ExecParallel 并发执行多个互不依赖的 SQL/CURL/BIN 模板，结果同样存储在 <name>Out，并发数量由仓库 ParallelLimit 控制
+// 容器为 SyncVolumeInterface(NewSyncVolume 创建) 或 NewVolume 创建的容器(Invoke 使用)，后者在执行期间加锁共用同一份数据
+func ExecParallel(volume VolumeInterface, templateNames ...string) (string, error) {
+	parallelVolume, ok := volume.(SyncVolumeInterface)
+	if !ok {
+		v, isMap := volume.(*volumeMap)
+		if !isMap {
+			err := errors.Errorf("execParallel required SyncVolumeInterface or NewVolume volume, got %T", volume)
+			return "", err
+		}
+		v.init()
+		parallelVolume = &syncVolume{data: *v} // 调用方模板在 execParallel 返回前阻塞，所有读写都经过锁
+	}
+	volume = parallelVolume
+	r, err := getRepositoryFromVolume(volume)
+	if err != nil {
+		return "", err
+	}
+	limit := r.ParallelLimit()
+	if limit < 1 || limit > len(templateNames) {
+		limit = len(templateNames)
+	}
+	sem := make(chan struct{}, limit)
+	errs := make([]error, len(templateNames))
+	var wg sync.WaitGroup
+	for i, templateName := range templateNames {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, templateName string) {
+			defer func() {
+				if panicInfo := recover(); panicInfo != nil {
+					errs[i] = recoverError(panicInfo)
+				}
+				<-sem
+				wg.Done()
+			}()
+			_, errs[i] = execTplByProvider(volume, templateName)
+		}(i, templateName)
+	}
+	wg.Wait()
+	parallelError := &ParallelError{}
+	for i, err := range errs {
+		if err != nil {
+			parallelError.TplNames = append(parallelError.TplNames, templateNames[i])
+			parallelError.Errors = append(parallelError.Errors, err)
+		}
+	}
+	if len(parallelError.Errors) > 0 {
+		return "", parallelError
+	}
+	return "", nil
+}
+
+// BeginTx 开启事务，之后的 execSQLTpl 共用事务直到 commit/rollback，模板执行出错或执行结束仍未提交时自动回滚
+func BeginTx(volume VolumeInterface) (string, error) {
+	ctx := getContextFromVolume(volume)
+	if _, ok := provider.TxManagerFromContext(ctx); ok {
+		err := errors.Errorf("beginTx: nested transaction not supported")
+		return "", err
+	}
+	txManager := provider.NewTxManager(ctx)
+	volume.SetValue(CONTEXT_KEY, txManager.Context())
+	return "", nil
+}
+
+func Commit(volume VolumeInterface) (string, error) {
+	return finishTx(volume, "commit", (*provider.TxManager).Commit)
+}
+
+func Rollback(volume VolumeInterface) (string, error) {
+	return finishTx(volume, "rollback", (*provider.TxManager).Rollback)
+}
+
+func finishTx(volume VolumeInterface, action string, fn func(txManager *provider.TxManager) error) (string, error) {
+	txManager, ok := provider.TxManagerFromContext(getContextFromVolume(volume))
+	if !ok {
+		err := errors.Errorf("%s: transaction not found, call beginTx first", action)
+		return "", err
+	}
+	volume.SetValue(CONTEXT_KEY, txManager.Parent())
+	err := fn(txManager)
+	if err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+// Transaction 在事务中执行模板，模板执行成功提交，失败回滚；已在事务中时加入当前事务
+func Transaction(volume VolumeInterface, templateName string) (string, error) {
+	if _, ok := provider.TxManagerFromContext(getContextFromVolume(volume)); ok {
+		return ExecuteTemplate(volume, templateName)
+	}
+	_, err := BeginTx(volume)
+	if err != nil {
+		return "", err
+	}
+	out, err := ExecuteTemplate(volume, templateName)
+	if err != nil {
+		Rollback(volume) // 返回模板执行的原始错误，忽略回滚错误
+		return "", err
+	}
+	_, err = Commit(volume)
+	if err != nil {
+		return "", err
+	}
+	return out, nil
 }
 
 //ToJson 将值转为字符串
@@ -400,6 +686,7 @@ func FormatJson(jsonStr string, jsonschema string) (string, error) {
 				if err != nil {
 					return "", err
 				}
+				continue
 			}
 			// 设置类型初始化值
 			var v interface{}
@@ -1,8 +1,21 @@
 package templatemap
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/templatemap/provider"
+	_ "modernc.org/sqlite"
 )
 
 func TestJsonSchema2Path(t *testing.T) {
@@ -87,3 +100,282 @@ func TestGetSetRow2Column(t *testing.T) {
 	volume.GetValue(key, &out)
 	fmt.Println(out)
 }
+
+type sqlExecproviderStub struct {
+	statement string
+	args      []interface{}
+}
+
+func (p *sqlExecproviderStub) Exec(identifier string, s string) (string, error) {
+	return "", errors.Errorf("sql must be executed by ExecSQL, got %s", s)
+}
+
+func (p *sqlExecproviderStub) ExecSQL(ctx context.Context, identifier string, statement string, args ...interface{}) (string, error) {
+	p.statement = statement
+	p.args = args
+	return "1", nil
+}
+
+func (p *sqlExecproviderStub) GetSource() (source interface{}) {
+	return nil
+}
+
+func TestExecSQLTplParameterized(t *testing.T) {
+	r := NewRepository()
+	r.AddTemplateByStr("getUser", "select * from `user` where `name`=:Name and `id` in ({{in . .IDList}})")
+	stub := &sqlExecproviderStub{}
+	r.RegisterMeta("getUser", &TemplateMeta{Name: "getUser", ExecProvider: stub})
+	volume := &volumeMap{
+		"Name":   "a' or '1'='1",
+		"IDList": []int{1, 2},
+	}
+	volume.SetValue(REPOSITORY_KEY, r)
+	_, err := ExecSQLTpl(volume, "getUser")
+	if err != nil {
+		panic(err)
+	}
+	if want := "select * from `user` where `name`=? and `id` in (?,?)"; stub.statement != want {
+		t.Errorf("statement got %s, want %s", stub.statement, want)
+	}
+	if len(stub.args) != 3 || stub.args[0] != "a' or '1'='1" {
+		t.Errorf("args got %#v", stub.args)
+	}
+	var sql string
+	volume.GetValue("getUserSQL", &sql)
+	fmt.Println(sql)
+}
+
+func newSQLiteProvider(t *testing.T) (*provider.DBExecProvider, *sql.DB) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		panic(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec("create table `user` (`id` integer primary key, `name` text not null)")
+	if err != nil {
+		panic(err)
+	}
+	execProvider := &provider.DBExecProvider{Config: provider.DBExecProviderConfig{Dialect: provider.DIALECT_SQLITE}}
+	execProvider.SetDb(db)
+	return execProvider, db
+}
+
+func TestExecSQLTplSQLite(t *testing.T) {
+	execProvider, _ := newSQLiteProvider(t)
+	r := NewRepository()
+	r.AddTemplateByStr("insertUser", "insert into `user` (`name`) values (:Name)")
+	r.AddTemplateByStr("getUser", "select `id`,`name`,1.5 as `score`,null as `deleted_at`,'it''s `ok`' as `note` from `user` where `name`=:Name")
+	for _, name := range []string{"insertUser", "getUser"} {
+		r.RegisterMeta(name, &TemplateMeta{Name: name, ExecProvider: execProvider})
+	}
+	r.AddTemplateByStr("main", `{{execSQLTpl . "insertUser"}}{{execSQLTpl . "getUser"}}{{getValue . "getUserOut"}}`)
+	volume := NewVolume(r)
+	volume.SetValue("Name", "O'Brien")
+	out, err := r.ExecuteTemplate("main", volume)
+	if err != nil {
+		panic(err)
+	}
+	if want := `[{"deleted_at":"","id":"1","name":"O'Brien","note":"it's ` + "`ok`" + `","score":"1.5"}]`; out != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+	var insertSQL string
+	volume.GetValue("insertUserSQL", &insertSQL)
+	if want := "insert into `user` (`name`) values ('O''Brien')"; insertSQL != want {
+		t.Errorf("insertUserSQL got %s, want %s", insertSQL, want)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	execProvider, db := newSQLiteProvider(t)
+	r := NewRepository()
+	r.AddTemplateByStr("insertUser", "insert into `user` (`name`) values (:Name)")
+	r.AddTemplateByStr("insertDuplicate", "insert into `user` (`id`,`name`) values (1,'duplicate')")
+	for _, name := range []string{"insertUser", "insertDuplicate"} {
+		r.RegisterMeta(name, &TemplateMeta{Name: name, ExecProvider: execProvider})
+	}
+	r.AddTemplateByStr("insertTwice", `{{execSQLTpl . "insertUser"}}{{execSQLTpl . "insertUser"}}`)
+	r.AddTemplateByStr("txCommit", `{{transaction . "insertTwice"}}`)
+	r.AddTemplateByStr("txFail", `{{beginTx .}}{{execSQLTpl . "insertUser"}}{{execSQLTpl . "insertDuplicate"}}{{commit .}}`)
+	r.AddTemplateByStr("txWrapperFail", `{{transaction . "txWrapperBody"}}`)
+	r.AddTemplateByStr("txWrapperBody", `{{execSQLTpl . "insertUser"}}{{execSQLTpl . "insertDuplicate"}}`)
+	r.AddTemplateByStr("txRollback", `{{beginTx .}}{{execSQLTpl . "insertUser"}}{{rollback .}}`)
+	r.AddTemplateByStr("txUncommitted", `{{beginTx .}}{{execSQLTpl . "insertUser"}}`)
+
+	count := func() (n int) {
+		err := db.QueryRow("select count(*) from `user`").Scan(&n)
+		if err != nil {
+			panic(err)
+		}
+		return n
+	}
+	volume := NewVolume(r)
+	volume.SetValue("Name", "张三")
+	if _, err := r.ExecuteTemplate("txCommit", volume); err != nil {
+		panic(err)
+	}
+	if n := count(); n != 2 {
+		t.Fatalf("after commit got %d rows, want 2", n)
+	}
+	for _, tplName := range []string{"txFail", "txWrapperFail", "txRollback", "txUncommitted"} {
+		_, err := r.ExecuteTemplate(tplName, volume)
+		if tplName != "txRollback" && err == nil {
+			t.Errorf("%s expected error", tplName)
+		}
+		if n := count(); n != 2 {
+			t.Errorf("%s not rolled back, got %d rows", tplName, n)
+		}
+		if _, ok := provider.TxManagerFromContext(getContextFromVolume(volume)); ok {
+			t.Errorf("%s transaction context not restored", tplName)
+		}
+		if inUse := db.Stats().InUse; inUse != 0 {
+			t.Errorf("%s transaction connection not released, in use %d", tplName, inUse)
+		}
+	}
+}
+
+func TestExecSQLStream(t *testing.T) {
+	execProvider, db := newSQLiteProvider(t)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if _, err := db.Exec("insert into `user` (`name`) values (?)", name); err != nil {
+			panic(err)
+		}
+	}
+	r := NewRepository()
+	r.AddTemplateByStr("export", "select `id`,`name` from `user` where `id`>:MinID order by `id`")
+	r.RegisterMeta("export", &TemplateMeta{Name: "export", ExecProvider: execProvider})
+	r.AddTemplateByStr("main", `{{range $batch := execSQLStream . "export" 2}}{{if $batch.Err}}{{$batch.Err}}{{end}}{{len $batch.Rows}}:{{range $batch.Rows}}{{.name}},{{end}};{{end}}`)
+	volume := NewVolume(r)
+	volume.SetValue("MinID", 0)
+	out, err := r.ExecuteTemplate("main", volume)
+	if err != nil {
+		panic(err)
+	}
+	if want := "2:a,b,;2:c,d,;1:e,;"; out != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+	var exportOut string
+	if volume.GetValue("exportOut", &exportOut) {
+		t.Errorf("stream result must not be stored in volume, got %s", exportOut)
+	}
+
+	var w bytes.Buffer
+	volume.SetValue("MinID", 3)
+	count, err := StreamSQLTpl(volume, "export", &w, provider.STREAM_FORMAT_NDJSON)
+	if err != nil {
+		panic(err)
+	}
+	if want := "{\"id\":\"4\",\"name\":\"d\"}\n{\"id\":\"5\",\"name\":\"e\"}\n"; count != 2 || w.String() != want {
+		t.Errorf("ndjson got %d %q, want %q", count, w.String(), want)
+	}
+	w.Reset()
+	count, err = StreamSQLTpl(volume, "export", &w, provider.STREAM_FORMAT_CSV)
+	if err != nil {
+		panic(err)
+	}
+	if want := "id,name\n4,d\n5,e\n"; count != 2 || w.String() != want {
+		t.Errorf("csv got %d %q, want %q", count, w.String(), want)
+	}
+	if _, err = StreamSQLTpl(volume, "export", &w, "xml"); err == nil {
+		t.Error("expected unknown format error")
+	}
+}
+
+func TestExecSQLStreamAbort(t *testing.T) {
+	execProvider, db := newSQLiteProvider(t)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if _, err := db.Exec("insert into `user` (`name`) values (?)", name); err != nil {
+			panic(err)
+		}
+	}
+	r := NewRepository()
+	r.AddTemplateByStr("export", "select `id`,`name` from `user` order by `id`")
+	r.RegisterMeta("export", &TemplateMeta{Name: "export", ExecProvider: execProvider})
+	r.AddTemplateByStr("main", `{{range $batch := execSQLStream . "export" 2}}{{panic 400 "stop" "stop"}}{{end}}`)
+	for i := 0; i < 3; i++ {
+		if _, err := r.ExecuteTemplate("main", NewVolume(r)); err == nil {
+			t.Fatal("expected panic error")
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for db.Stats().InUse > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond) // 协程收到取消后异步关闭 rows
+	}
+	if inUse := db.Stats().InUse; inUse != 0 {
+		t.Errorf("aborted stream connections not released, in use %d", inUse)
+	}
+}
+
+func TestExecCURLTplStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "not found")
+	}))
+	defer server.Close()
+	r := NewRepository()
+	r.AddTemplateByStr("getUser", fmt.Sprintf("GET %s/user HTTP/1.1\nHost: %s\n", server.URL, strings.TrimPrefix(server.URL, "http://")))
+	r.RegisterMeta("getUser", &TemplateMeta{Name: "getUser", ExecProvider: &provider.CURLExecProvider{}})
+	r.AddTemplateByStr("main", `{{execCURLTpl . "getUser"}}`)
+	volume := NewVolume(r)
+	_, err := r.ExecuteTemplate("main", volume)
+	var statusError *provider.HTTPStatusError
+	if !errors.As(err, &statusError) || statusError.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected HTTPStatusError, got %v", err)
+	}
+	var out string
+	volume.GetValue("getUserOut", &out)
+	if !strings.Contains(out, `"httpStatus":"404"`) {
+		t.Errorf("getUserOut got %s", out)
+	}
+
+	r.AddTemplateByStr("findUser", fmt.Sprintf("GET %s/user HTTP/1.1\nHost: %s\n%s: 2xx,404\n", server.URL, strings.TrimPrefix(server.URL, "http://"), provider.HTTP_HEADER_SUCCESS_STATUS))
+	r.RegisterMeta("findUser", &TemplateMeta{Name: "findUser", ExecProvider: &provider.CURLExecProvider{}})
+	r.AddTemplateByStr("branch", `{{execCURLTpl . "findUser"}}{{if eq (getValue . "findUserOut.httpStatus") "404"}}missing{{else}}found{{end}}`)
+	branchOut, err := r.ExecuteTemplate("branch", NewVolume(r))
+	if err != nil {
+		panic(err)
+	}
+	if branchOut != "missing" {
+		t.Errorf("branch on httpStatus got %s, want missing", branchOut)
+	}
+}
+
+func TestFormTemplateFunc(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseMultipartForm(1 << 20)
+		if err != nil {
+			panic(err)
+		}
+		file := r.MultipartForm.File["avatar"][0]
+		fmt.Fprintf(w, "%s|%s|%s|%s", r.PostForm.Get("name"), strings.Join(r.PostForm["tags"], ","), file.Filename, file.Header.Get("Content-Type"))
+	}))
+	defer server.Close()
+	file := filepath.Join(t.TempDir(), "avatar.bin")
+	if err := os.WriteFile(file, []byte{0, 1, 2}, 0o644); err != nil {
+		panic(err)
+	}
+	r := NewRepository()
+	r.AddTemplateByStr("form", `{{formEncode .form}}|{{formEncode "b" 1 "a" "x y"}}`)
+	r.AddTemplateByStr("upload", fmt.Sprintf("POST %s/upload HTTP/1.1\nHost: %s\nContent-Type: multipart/form-data\n\n", server.URL, strings.TrimPrefix(server.URL, "http://"))+
+		`{{formData "name" .name "tags" .tags "avatar" (multipartFile .file "a.png")}}`)
+	r.RegisterMeta("upload", &TemplateMeta{Name: "upload", ExecProvider: &provider.CURLExecProvider{}})
+	r.AddTemplateByStr("main", `{{execCURLTpl . "upload"}}{{getValue . "uploadOut.body"}}`)
+	volume := NewVolume(r)
+	volume.SetValue("form", map[string]interface{}{"tags": []interface{}{1, "&"}, "a": nil, "user": map[string]interface{}{"id": 1}})
+	volume.SetValue("name", "张三")
+	volume.SetValue("tags", []string{"a", "b"})
+	volume.SetValue("file", file)
+	out, err := r.ExecuteTemplate("form", volume)
+	if err != nil {
+		panic(err)
+	}
+	if want := "a=&tags=1&tags=%26&user=%7B%22id%22%3A1%7D|b=1&a=x+y"; out != want {
+		t.Errorf("formEncode got %s, want %s", out, want)
+	}
+	out, err = r.ExecuteTemplate("main", volume)
+	if err != nil {
+		panic(err)
+	}
+	if want := "张三|a,b|a.png|image/png"; out != want {
+		t.Errorf("formData got %s, want %s", out, want)
+	}
+}
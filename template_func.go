@@ -7,12 +7,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/rs/xid"
+	"github.com/suifengpiao14/templatemap/provider"
 	"github.com/suifengpiao14/templatemap/util"
 	"goa.design/goa/v3/codegen"
 )
@@ -36,6 +39,9 @@ var TemplatefuncMap = template.FuncMap{
 	"standardizeSpaces": util.StandardizeSpaces,
 	"column2Row":        util.Column2Row,
 	"row2Column":        util.Row2Column,
+	"formEncode":        FormEncode,
+	"formData":          FormData,
+	"multipartFile":     MultipartFile,
 }
 
 const IN_INDEX = "__inIndex"
@@ -116,36 +122,20 @@ func (c *preComma) PreComma() string {
 }
 
 func In(volume VolumeInterface, data interface{}) (str string, err error) {
-	placeholders := make([]string, 0)
-	inIndexKey := IN_INDEX
-	var inIndex int
-	ok := volume.GetValue(inIndexKey, &inIndex)
-	if !ok {
-		inIndex = 0
-	}
-
+	values := make([]interface{}, 0)
 	v := reflect.Indirect(reflect.ValueOf(data))
 
 	switch v.Kind() {
 	case reflect.Array, reflect.Slice:
 		num := v.Len()
 		for i := 0; i < num; i++ {
-			inIndex++
-			named := fmt.Sprintf("in_%d", inIndex)
-			placeholder := ":" + named
-			placeholders = append(placeholders, placeholder)
-			volume.SetValue(named, v.Index(i).Interface())
+			values = append(values, v.Index(i).Interface())
 		}
 
 	case reflect.String:
 		arr := strings.Split(v.String(), ",")
-		num := len(arr)
-		for i := 0; i < num; i++ {
-			inIndex++
-			named := fmt.Sprintf("in_%d", inIndex)
-			placeholder := ":" + named
-			placeholders = append(placeholders, placeholder)
-			volume.SetValue(named, arr[i])
+		for _, val := range arr {
+			values = append(values, val)
 		}
 	default:
 		err = fmt.Errorf("want slice/array/string ,have %s", v.Kind().String())
@@ -153,12 +143,30 @@ func In(volume VolumeInterface, data interface{}) (str string, err error) {
 			return "", err
 		}
 	}
-	volume.SetValue(inIndexKey, inIndex) // 更新InIndex_
+	inIndex := reserveInIndex(volume, len(values))
+	placeholders := make([]string, 0, len(values))
+	for _, val := range values {
+		inIndex++
+		named := fmt.Sprintf("in_%d", inIndex)
+		placeholder := ":" + named
+		placeholders = append(placeholders, placeholder)
+		volume.SetValue(named, val)
+	}
 	str = strings.Join(placeholders, ",")
 	return str, nil
 
 }
 
+// reserveInIndex 预留 num 个 in_N 占位符序号，返回预留前的序号，并发安全容器使用 Incr 保证序号不重复
+func reserveInIndex(volume VolumeInterface, num int) (inIndex int) {
+	if syncVolume, ok := volume.(SyncVolumeInterface); ok {
+		return syncVolume.Incr(IN_INDEX, num) - num
+	}
+	volume.GetValue(IN_INDEX, &inIndex)
+	volume.SetValue(IN_INDEX, inIndex+num) // 更新InIndex_
+	return inIndex
+}
+
 // 封装 goa.design/goa/v3/codegen 方便后续可定制
 func ToCamel(name string) string {
 	return codegen.CamelCase(name, true, true)
@@ -210,3 +218,101 @@ func JsonCompact(src string) (out string, err error) {
 	return
 
 }
+
+// FormEncode 生成 application/x-www-form-urlencoded 请求体，参数为 map、json 对象字符串(按键排序)或 key value 对(保持顺序)，数组生成同名多个字段
+func FormEncode(args ...interface{}) (string, error) {
+	fields, err := toFormFields(args...)
+	if err != nil {
+		return "", err
+	}
+	return provider.EncodeForm(fields)
+}
+
+// FormData 生成表单字段 json 作为请求体，参数同 formEncode，文件字段使用 multipartFile；
+// 请求头 Content-Type 为 multipart/form-data(不含 boundary) 时由 CURL 执行器编码，application/x-www-form-urlencoded 需同时设置请求头 x-http-form-data: 1
+func FormData(args ...interface{}) (string, error) {
+	fields, err := toFormFields(args...)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// MultipartFile multipart 文件字段，path 为执行器所在机器的文件路径，可选参数依次为 filename、contentType
+func MultipartFile(path string, opts ...string) provider.FormField {
+	field := provider.FormField{File: path}
+	if len(opts) > 0 {
+		field.Filename = opts[0]
+	}
+	if len(opts) > 1 {
+		field.ContentType = opts[1]
+	}
+	return field
+}
+
+func toFormFields(args ...interface{}) ([]provider.FormField, error) {
+	fields := make([]provider.FormField, 0)
+	if len(args) == 1 {
+		data := args[0]
+		if s, ok := data.(string); ok {
+			m := make(map[string]interface{})
+			decoder := json.NewDecoder(strings.NewReader(s))
+			decoder.UseNumber()
+			if err := decoder.Decode(&m); err != nil {
+				err = errors.WithMessage(err, "form data want json object")
+				return nil, err
+			}
+			data = m
+		}
+		rv := reflect.ValueOf(data)
+		if rv.Kind() != reflect.Map {
+			err := errors.Errorf("form data want map or json object, got %T", data)
+			return nil, err
+		}
+		keys := make([]string, 0, rv.Len())
+		values := make(map[string]interface{}, rv.Len())
+		for _, key := range rv.MapKeys() {
+			name := strval(key.Interface())
+			keys = append(keys, name)
+			values[name] = rv.MapIndex(key).Interface()
+		}
+		sort.Strings(keys)
+		for _, name := range keys {
+			fields = appendFormField(fields, name, values[name])
+		}
+		return fields, nil
+	}
+	if len(args)%2 != 0 {
+		err := errors.Errorf("form data want key value pairs, got %d args", len(args))
+		return nil, err
+	}
+	for i := 0; i < len(args); i += 2 {
+		fields = appendFormField(fields, strval(args[i]), args[i+1])
+	}
+	return fields, nil
+}
+
+// appendFormField 数组展开为同名字段，对象转换为 json 字符串，只有 multipartFile 生成文件字段
+func appendFormField(fields []provider.FormField, name string, value interface{}) []provider.FormField {
+	switch v := value.(type) {
+	case nil:
+		return append(fields, provider.FormField{Name: name})
+	case provider.FormField:
+		v.Name = name
+		return append(fields, v)
+	case string, []byte:
+		return append(fields, provider.FormField{Name: name, Value: strval(v)})
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		for i := 0; i < rv.Len(); i++ {
+			fields = appendFormField(fields, name, rv.Index(i).Interface())
+		}
+		return fields
+	}
+	return append(fields, provider.FormField{Name: name, Value: strval(value)})
+}
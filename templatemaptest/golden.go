@@ -0,0 +1,61 @@
+// Package templatemaptest 模板回归测试工具: 录制回放执行器及 golden 文件比对，
+// 设置环境变量 TEMPLATEMAP_RECORD=1 运行测试时调用真实执行器录制夹具并更新 golden 文件，否则离线回放
+package templatemaptest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/suifengpiao14/templatemap"
+	"github.com/suifengpiao14/templatemap/provider"
+)
+
+const RECORD_ENV = "TEMPLATEMAP_RECORD"
+
+// Recording 是否为录制模式
+func Recording() bool {
+	return os.Getenv(RECORD_ENV) != ""
+}
+
+// ReplayProvider 包装真实执行器，录制模式下调用 execProvider 并将结果保存到 dir，否则从 dir 回放
+func ReplayProvider(dir string, execProvider provider.ExecproviderInterface) provider.ExecproviderInterface {
+	mode := provider.REPLAY_MODE_REPLAY
+	if Recording() {
+		mode = provider.REPLAY_MODE_RECORD
+	}
+	return provider.NewReplayExecProvider(mode, dir, execProvider)
+}
+
+// AssertGolden 比较 got 与 golden 文件内容，录制模式下写入 golden 文件
+func AssertGolden(t testing.TB, goldenFile string, got string) {
+	t.Helper()
+	if Recording() {
+		err := os.MkdirAll(filepath.Dir(goldenFile), 0o755)
+		if err == nil {
+			err = os.WriteFile(goldenFile, []byte(got), 0o644)
+		}
+		if err != nil {
+			t.Fatalf("write golden file %s: %v", goldenFile, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatalf("read golden file %s: %v (run with %s=1 to create)", goldenFile, err, RECORD_ENV)
+	}
+	if got != string(want) {
+		t.Errorf("golden file %s mismatch (run with %s=1 to update)\ngot:\n%s\nwant:\n%s", goldenFile, RECORD_ENV, got, want)
+	}
+}
+
+// ExecuteTemplateGolden 执行模板并与 golden 文件比对，返回模板输出
+func ExecuteTemplateGolden(t testing.TB, r templatemap.RepositoryInterface, tplName string, volume templatemap.VolumeInterface, goldenFile string) string {
+	t.Helper()
+	out, err := r.ExecuteTemplate(tplName, volume)
+	if err != nil {
+		t.Fatalf("execute template %s: %+v", tplName, err)
+	}
+	AssertGolden(t, goldenFile, out)
+	return out
+}
@@ -0,0 +1,43 @@
+package templatemaptest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/suifengpiao14/templatemap"
+	"github.com/suifengpiao14/templatemap/provider"
+	_ "modernc.org/sqlite"
+)
+
+// newDBProvider 录制时使用的数据库，回放时不会访问
+func newDBProvider(t *testing.T) *provider.DBExecProvider {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		panic(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, s := range []string{
+		"create table `user` (`name` text not null, `email` text not null)",
+		"insert into `user` (`name`,`email`) values ('张三','zhangsan@example.com'),('李四','lisi@example.com')",
+	} {
+		if _, err = db.Exec(s); err != nil {
+			panic(err)
+		}
+	}
+	execProvider := &provider.DBExecProvider{Config: provider.DBExecProviderConfig{Dialect: provider.DIALECT_SQLITE}}
+	execProvider.SetDb(db)
+	return execProvider
+}
+
+func TestExecuteTemplateGolden(t *testing.T) {
+	r := templatemap.NewRepository()
+	r.AddTemplateByStr("getUser", "select `name`,`email` from `user` where `name`=:Name")
+	r.AddTemplateByStr("main", `{{execSQLTpl . "getUser"}}{{getValue . "getUserOut"}}`)
+	execProvider := ReplayProvider(filepath.Join("testdata", "fixtures"), newDBProvider(t))
+	r.RegisterMeta("getUser", &templatemap.TemplateMeta{Name: "getUser", ExecProvider: execProvider})
+
+	volume := templatemap.NewVolume(r)
+	volume.SetValue("Name", "张三")
+	ExecuteTemplateGolden(t, r, "main", volume, filepath.Join("testdata", "main.golden"))
+}
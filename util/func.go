@@ -170,14 +170,38 @@ func Validate(input string, jsonLoader gojsonschema.JSONLoader) (err error) {
 		return nil
 	}
 
-	msgArr := make([]string, 0)
+	validateError := &ValidateError{Errors: make([]ValidateFieldError, 0)}
 	for _, resultError := range result.Errors() {
-		msgArr = append(msgArr, resultError.String())
+		validateError.Errors = append(validateError.Errors, ValidateFieldError{
+			Field:       resultError.Field(),
+			Type:        resultError.Type(),
+			Description: resultError.Description(),
+		})
 	}
-	err = errors.Errorf("input args validate errors: %s", strings.Join(msgArr, ","))
+	err = errors.WithStack(validateError)
 	return err
 }
 
+// ValidateFieldError 单个字段的校验错误，Type 为 gojsonschema 错误类型，如 required、invalid_type
+type ValidateFieldError struct {
+	Field       string `json:"field"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// ValidateError 输入数据不符合 json schema，调用方通过 errors.As 获取字段错误
+type ValidateError struct {
+	Errors []ValidateFieldError
+}
+
+func (e *ValidateError) Error() string {
+	msgArr := make([]string, 0, len(e.Errors))
+	for _, fieldError := range e.Errors {
+		msgArr = append(msgArr, fmt.Sprintf("%s: %s", fieldError.Field, fieldError.Description))
+	}
+	return fmt.Sprintf("input args validate errors: %s", strings.Join(msgArr, ","))
+}
+
 // Column2Row 列数据(二维数组中一维为列对象，二维为值数组)转行数据(二维数组中，一维为行索引，二维为行对象) gjson 获取数据时，会将行数据，转换成列数据，此时需要调用该函数再转换为行数据
 func Column2Row(jsonStr string) (out string) {
 	arr := make(map[string][]interface{}, 0)